@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	CreatedAtColumn = "created_at"
+	UpdatedAtColumn = "updated_at"
+	DeletedAtColumn = "deleted_at"
+	CreatedByColumn = "created_by"
+
+	notDeletedCondition = DeletedAtColumn + " IS NULL"
+	anyRowCondition     = "1 = 1"
+)
+
+// identifierRegexp matches the table and column names, optionally qualified, that are safe to put in a query.
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type withDeletedContextKey struct{}
+
+// AuditColumns the audit columns shared by most tables. Embed it in the row structs to scan them.
+type AuditColumns struct {
+	CreatedAt time.Time    `db:"created_at"`
+	UpdatedAt time.Time    `db:"updated_at"`
+	DeletedAt sql.NullTime `db:"deleted_at"`
+	CreatedBy string       `db:"created_by"`
+}
+
+// IsDeleted returns true if the row was soft deleted.
+func (columns AuditColumns) IsDeleted() bool {
+	return columns.DeletedAt.Valid
+}
+
+// WithActor returns a copy of the context carrying the user acting on the request, the same as log.WithActor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return log.WithActor(ctx, actor)
+}
+
+// ActorFromContext returns the user acting on the request or an empty string if there is none.
+func ActorFromContext(ctx context.Context) string {
+	return log.ActorFromContext(ctx)
+}
+
+// WithDeleted returns a copy of the context whose reads include soft deleted rows.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedContextKey{}, true)
+}
+
+// IncludesDeleted returns true if the reads made with the context must include soft deleted rows.
+func IncludesDeleted(ctx context.Context) bool {
+	included, _ := ctx.Value(withDeletedContextKey{}).(bool)
+
+	return included
+}
+
+// IsValidIdentifier returns true if the name is a table or column name, optionally qualified, safe to put in a query.
+func IsValidIdentifier(name string) bool {
+	return identifierRegexp.MatchString(name)
+}
+
+// NotDeleted returns the condition filtering out soft deleted rows, to be used in hand written queries.
+// It returns an always true condition when the context includes deleted rows.
+func NotDeleted(ctx context.Context) string {
+	if IncludesDeleted(ctx) {
+		return anyRowCondition
+	}
+
+	return notDeletedCondition
+}
+
+// AuditedRepository the repository helpers for tables carrying the audit columns.
+// The where conditions are wrapped in parentheses and combined with the audit condition, so they only accept predicates
+// with their values passed as placeholder args. Conditions that could escape the parentheses are rejected; write the
+// query by hand with NotDeleted for clauses such as ORDER BY or LIMIT.
+type AuditedRepository interface {
+	// Insert inserts a row stamping created_at, updated_at and created_by.
+	Insert(ctx context.Context, values map[string]interface{}) (sql.Result, error)
+	// Update updates the non deleted rows matching the condition stamping updated_at.
+	Update(ctx context.Context, values map[string]interface{}, where string, args ...interface{}) (sql.Result, error)
+	// Delete soft deletes the rows matching the condition stamping deleted_at.
+	Delete(ctx context.Context, where string, args ...interface{}) (sql.Result, error)
+	// Restore clears deleted_at in the rows matching the condition.
+	Restore(ctx context.Context, where string, args ...interface{}) (sql.Result, error)
+	// Get reads a single row matching the condition, skipping soft deleted rows unless the context includes them.
+	Get(ctx context.Context, dest interface{}, where string, args ...interface{}) error
+	// Select reads the rows matching the condition, skipping soft deleted rows unless the context includes them.
+	Select(ctx context.Context, dest interface{}, where string, args ...interface{}) error
+}
+
+type auditedRepository struct {
+	client Client
+	table  string
+	now    func() time.Time
+}
+
+// NewAuditedRepository creates the repository helpers for the given table.
+func NewAuditedRepository(client Client, table string) (AuditedRepository, error) {
+	if client == nil {
+		return nil, voraserror.New(nil, "audited repository database client cannot be nil")
+	}
+
+	if !IsValidIdentifier(table) {
+		return nil, voraserror.New(nil, fmt.Sprintf("audited repository table %q is not valid", table))
+	}
+
+	return &auditedRepository{client: client, table: table, now: time.Now}, nil
+}
+
+func (repository *auditedRepository) Insert(ctx context.Context, values map[string]interface{}) (sql.Result, error) {
+	now := repository.now().UTC()
+
+	stamped := copyValues(values)
+	stamped[CreatedAtColumn] = now
+	stamped[UpdatedAtColumn] = now
+	stamped[CreatedByColumn] = ActorFromContext(ctx)
+
+	columns, args, err := sortedColumns(stamped)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", repository.table, strings.Join(columns, ", "),
+		placeholders)
+
+	return repository.client.Exec(query, args...)
+}
+
+func (repository *auditedRepository) Update(ctx context.Context, values map[string]interface{}, where string,
+	args ...interface{}) (sql.Result, error) {
+	stamped := copyValues(values)
+	stamped[UpdatedAtColumn] = repository.now().UTC()
+
+	delete(stamped, CreatedAtColumn)
+	delete(stamped, CreatedByColumn)
+	delete(stamped, DeletedAtColumn)
+
+	columns, setArgs, err := sortedColumns(stamped)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = column + " = ?"
+	}
+
+	condition, err := whereClause(NotDeleted(ctx), where)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", repository.table, strings.Join(assignments, ", "), condition)
+
+	return repository.client.Exec(query, append(setArgs, args...)...)
+}
+
+func (repository *auditedRepository) Delete(ctx context.Context, where string, args ...interface{}) (sql.Result,
+	error) {
+	condition, err := whereClause(notDeletedCondition, where)
+	if err != nil {
+		return nil, err
+	}
+
+	now := repository.now().UTC()
+	query := fmt.Sprintf("UPDATE %s SET %s = ?, %s = ? WHERE %s", repository.table, DeletedAtColumn,
+		UpdatedAtColumn, condition)
+
+	return repository.client.Exec(query, append([]interface{}{now, now}, args...)...)
+}
+
+func (repository *auditedRepository) Restore(ctx context.Context, where string, args ...interface{}) (sql.Result,
+	error) {
+	condition, err := whereClause(DeletedAtColumn+" IS NOT NULL", where)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s = NULL, %s = ? WHERE %s", repository.table, DeletedAtColumn,
+		UpdatedAtColumn, condition)
+
+	return repository.client.Exec(query, append([]interface{}{repository.now().UTC()}, args...)...)
+}
+
+func (repository *auditedRepository) Get(ctx context.Context, dest interface{}, where string,
+	args ...interface{}) error {
+	condition, err := whereClause(NotDeleted(ctx), where)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", repository.table, condition)
+
+	return repository.client.Get(dest, query, args...)
+}
+
+func (repository *auditedRepository) Select(ctx context.Context, dest interface{}, where string,
+	args ...interface{}) error {
+	condition, err := whereClause(NotDeleted(ctx), where)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", repository.table, condition)
+
+	return repository.client.Select(dest, query, args...)
+}
+
+// whereClause combines the audit condition with the caller condition, which may be empty, wrapping the caller
+// condition in parentheses so it cannot widen the audit condition.
+func whereClause(condition, where string) (string, error) {
+	if strings.TrimSpace(where) == "" {
+		return condition, nil
+	}
+
+	if !isEnclosable(where) {
+		return "", voraserror.New(nil, fmt.Sprintf("where condition %q must be a single predicate", where))
+	}
+
+	return fmt.Sprintf("%s AND (%s)", condition, where), nil
+}
+
+// isEnclosable returns true if the condition stays inside the parentheses it is wrapped in: its quotes are closed, its
+// parentheses balanced and it has no statement separators or comments outside the quoted literals.
+func isEnclosable(where string) bool {
+	depth := 0
+
+	var quote byte
+
+	for i := 0; i < len(where); i++ {
+		char := where[i]
+
+		if quote != 0 {
+			switch {
+			case char == '\\' && quote != '`':
+				i++
+			case char == quote:
+				quote = 0
+			}
+
+			continue
+		}
+
+		switch char {
+		case '\'', '"', '`':
+			quote = char
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return false
+			}
+		case ';', '#':
+			return false
+		case '-', '/':
+			if strings.HasPrefix(where[i:], "--") || strings.HasPrefix(where[i:], "/*") {
+				return false
+			}
+		}
+	}
+
+	return quote == 0 && depth == 0
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values)+3)
+	for column, value := range values {
+		copied[column] = value
+	}
+
+	return copied
+}
+
+// sortedColumns returns the column names in a stable order with their values, rejecting invalid identifiers.
+func sortedColumns(values map[string]interface{}) ([]string, []interface{}, error) {
+	columns := make([]string, 0, len(values))
+
+	for column := range values {
+		if !IsValidIdentifier(column) {
+			return nil, nil, voraserror.New(nil, fmt.Sprintf("column %q is not valid", column))
+		}
+
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		args[i] = values[column]
+	}
+
+	return columns, args, nil
+}
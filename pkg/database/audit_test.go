@@ -0,0 +1,220 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+)
+
+// fakeClient records the statements it receives.
+type fakeClient struct {
+	queries []string
+	args    [][]interface{}
+	err     error
+	get     func(dest interface{}) error
+}
+
+func (client *fakeClient) record(query string, args []interface{}) {
+	client.queries = append(client.queries, query)
+	client.args = append(client.args, args)
+}
+
+func (client *fakeClient) Exec(query string, args ...interface{}) (sql.Result, error) {
+	client.record(query, args)
+
+	return nil, client.err
+}
+
+func (client *fakeClient) Get(dest interface{}, query string, args ...interface{}) error {
+	client.record(query, args)
+
+	if client.get != nil && client.err == nil {
+		return client.get(dest)
+	}
+
+	return client.err
+}
+
+func (client *fakeClient) Select(dest interface{}, query string, args ...interface{}) error {
+	return client.Get(dest, query, args...)
+}
+
+func (client *fakeClient) Prepare(query string) (*sql.Stmt, error) {
+	client.record(query, nil)
+
+	return nil, client.err
+}
+
+func (client *fakeClient) Beginx() (*sqlx.Tx, error) {
+	return nil, client.err
+}
+
+func (client *fakeClient) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	client.record(query, args)
+
+	return nil, client.err
+}
+
+func TestAuditedRepository_Insert(t *testing.T) {
+	client := &fakeClient{}
+	repository, err := database.NewAuditedRepository(client, "users")
+	assert.Nil(t, err, "Unexpected error creating audited repository")
+
+	ctx := database.WithActor(context.Background(), "admin")
+
+	_, err = repository.Insert(ctx, map[string]interface{}{"name": "John"})
+	assert.Nil(t, err, "Unexpected error inserting row")
+
+	assert.Equal(t, "INSERT INTO users (created_at, created_by, name, updated_at) VALUES (?, ?, ?, ?)",
+		client.queries[0], "Query is not the expected")
+	assert.Equal(t, "admin", client.args[0][1], "Created by is not the expected")
+	assert.Equal(t, "John", client.args[0][2], "Name is not the expected")
+}
+
+func TestAuditedRepository_Insert_InvalidColumn(t *testing.T) {
+	repository, err := database.NewAuditedRepository(&fakeClient{}, "users")
+	assert.Nil(t, err, "Unexpected error creating audited repository")
+
+	_, err = repository.Insert(context.Background(), map[string]interface{}{"name; DROP TABLE users": "John"})
+
+	assert.NotNil(t, err, "Invalid column should be rejected")
+}
+
+func TestAuditedRepository_Update(t *testing.T) {
+	client := &fakeClient{}
+	repository, err := database.NewAuditedRepository(client, "users")
+	assert.Nil(t, err, "Unexpected error creating audited repository")
+
+	_, err = repository.Update(context.Background(), map[string]interface{}{"name": "Jane", "created_by": "x"},
+		"id = ?", 1)
+	assert.Nil(t, err, "Unexpected error updating row")
+
+	assert.Equal(t, "UPDATE users SET name = ?, updated_at = ? WHERE deleted_at IS NULL AND (id = ?)",
+		client.queries[0], "Query is not the expected")
+	assert.Equal(t, 1, client.args[0][2], "Where argument is not the expected")
+}
+
+func TestAuditedRepository_Delete(t *testing.T) {
+	client := &fakeClient{}
+	repository, err := database.NewAuditedRepository(client, "users")
+	assert.Nil(t, err, "Unexpected error creating audited repository")
+
+	_, err = repository.Delete(context.Background(), "id = ?", 1)
+	assert.Nil(t, err, "Unexpected error deleting row")
+
+	assert.Equal(t, "UPDATE users SET deleted_at = ?, updated_at = ? WHERE deleted_at IS NULL AND (id = ?)",
+		client.queries[0], "Query is not the expected")
+}
+
+func TestAuditedRepository_Select(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		where string
+		want  string
+	}{
+		{
+			name:  "Soft deleted rows are filtered out by default",
+			ctx:   context.Background(),
+			where: "name = ?",
+			want:  "SELECT * FROM users WHERE deleted_at IS NULL AND (name = ?)",
+		},
+		{
+			name:  "Soft deleted rows are included when requested",
+			ctx:   database.WithDeleted(context.Background()),
+			where: "name = ?",
+			want:  "SELECT * FROM users WHERE 1 = 1 AND (name = ?)",
+		},
+		{
+			name:  "Empty condition only filters soft deleted rows",
+			ctx:   context.Background(),
+			where: "",
+			want:  "SELECT * FROM users WHERE deleted_at IS NULL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			repository, err := database.NewAuditedRepository(client, "users")
+			assert.Nil(t, err, "Unexpected error creating audited repository")
+
+			var dest []struct{}
+
+			err = repository.Select(tt.ctx, &dest, tt.where)
+			assert.Nil(t, err, "Unexpected error selecting rows")
+
+			assert.Equal(t, tt.want, client.queries[0], "Query is not the expected")
+		})
+	}
+}
+
+func TestAuditedRepository_Select_OnlyPredicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		where     string
+		wantedErr bool
+	}{
+		{
+			name:      "Condition closing the parentheses is rejected",
+			where:     "name = ?) OR (1 = 1",
+			wantedErr: true,
+		},
+		{
+			name:      "Additional statements are rejected",
+			where:     "name = ?; DELETE FROM users",
+			wantedErr: true,
+		},
+		{
+			name:      "Comments are rejected",
+			where:     "name = ? -- trailing",
+			wantedErr: true,
+		},
+		{
+			name:      "Unclosed literals are rejected",
+			where:     "name = 'John",
+			wantedErr: true,
+		},
+		{
+			name:  "Keywords and parentheses inside literals are accepted",
+			where: "name = ? AND plan IN ('limit', 'order by', ')') AND note <> 'it''s; fine'",
+		},
+		{
+			name:  "Nested predicates are accepted",
+			where: "(name = ? OR name = 'Jane') AND (age > 18)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			repository, err := database.NewAuditedRepository(client, "users")
+			assert.Nil(t, err, "Unexpected error creating audited repository")
+
+			var dest []struct{}
+
+			err = repository.Select(context.Background(), &dest, tt.where, "John")
+
+			if tt.wantedErr {
+				assert.NotNil(t, err, "Condition escaping the parentheses should be rejected")
+				assert.Empty(t, client.queries, "No query should be executed")
+
+				return
+			}
+
+			assert.Nil(t, err, "Unexpected error selecting rows")
+			assert.Equal(t, "SELECT * FROM users WHERE deleted_at IS NULL AND ("+tt.where+")", client.queries[0],
+				"Query is not the expected")
+		})
+	}
+}
+
+func TestIsValidIdentifier(t *testing.T) {
+	assert.True(t, database.IsValidIdentifier("billing.users"), "Qualified names should be valid")
+	assert.False(t, database.IsValidIdentifier("users; DROP TABLE users"), "Statements should not be valid")
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "First attempt waits the base delay",
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "Third attempt doubles the delay twice",
+			attempt: 3,
+			want:    4 * time.Second,
+		},
+		{
+			name:    "Delay is capped at the max",
+			attempt: 20,
+			want:    time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoff(tt.attempt, time.Second, time.Minute)
+
+			assert.Equal(t, tt.want, got, "Backoff is not the expected")
+		})
+	}
+}
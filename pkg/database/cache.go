@@ -0,0 +1,145 @@
+package database
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const defaultLRUCapacity = 1024
+
+// Cache the query result cache backend interface. Values are the encoded query results so remote backends can store
+// them as they are.
+type Cache interface {
+	// Get returns the value stored for the key if it exists and has not expired.
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key during the TTL and associates it with the given tags.
+	Set(key string, value []byte, ttl time.Duration, tags ...string)
+	// Delete removes the value stored for the key.
+	Delete(key string)
+	// InvalidateTag removes every value associated with the tag.
+	InvalidateTag(tag string)
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+	tags      []string
+}
+
+// lruCache an in-memory Cache evicting the least recently used entries once its capacity is reached.
+type lruCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	tags     map[string]map[string]struct{}
+	now      func() time.Time
+}
+
+// NewLRUCache creates an in-memory cache holding up to capacity entries.
+// A capacity lower than one uses the default capacity.
+func NewLRUCache(capacity int) Cache {
+	if capacity < 1 {
+		capacity = defaultLRUCapacity
+	}
+
+	return &lruCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		tags:     make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+func (cache *lruCache) Get(key string) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !cache.now().Before(entry.expiresAt) {
+		cache.remove(element)
+
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+
+	return entry.value, true
+}
+
+func (cache *lruCache) Set(key string, value []byte, ttl time.Duration, tags ...string) {
+	if ttl <= 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+
+	entry := &lruEntry{key: key, value: value, expiresAt: cache.now().Add(ttl), tags: tags}
+	cache.entries[key] = cache.order.PushFront(entry)
+
+	for _, tag := range tags {
+		keys, ok := cache.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			cache.tags[tag] = keys
+		}
+
+		keys[key] = struct{}{}
+	}
+
+	for cache.order.Len() > cache.capacity {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *lruCache) Delete(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+}
+
+func (cache *lruCache) InvalidateTag(tag string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for key := range cache.tags[tag] {
+		if element, ok := cache.entries[key]; ok {
+			cache.remove(element)
+		}
+	}
+
+	delete(cache.tags, tag)
+}
+
+// remove deletes the entry and its tag references. The mutex must be held.
+func (cache *lruCache) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+
+	cache.order.Remove(element)
+	delete(cache.entries, entry.key)
+
+	for _, tag := range entry.tags {
+		keys := cache.tags[tag]
+		delete(keys, entry.key)
+
+		if len(keys) == 0 {
+			delete(cache.tags, tag)
+		}
+	}
+}
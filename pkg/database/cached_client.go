@@ -0,0 +1,301 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+)
+
+// CachedClient a database client caching the results of its Get and Select queries.
+type CachedClient interface {
+	Client
+	// InvalidateTag removes the cached results of every query registered with the tag.
+	InvalidateTag(tag string)
+}
+
+// CachedClientBuilder the cached database client builder interface.
+type CachedClientBuilder interface {
+	WithCache(cache Cache) CachedClientBuilder
+	WithDefaultTTL(ttl time.Duration) CachedClientBuilder
+	WithQueryTTL(query string, ttl time.Duration, tags ...string) CachedClientBuilder
+	Build() (CachedClient, error)
+}
+
+type cachePolicy struct {
+	ttl  time.Duration
+	tags []string
+}
+
+// cachedClientBuilder the cached database client builder.
+type cachedClientBuilder struct {
+	client     Client
+	cache      Cache
+	defaultTTL time.Duration
+	policies   map[string]cachePolicy
+}
+
+// NewCachedClientBuilder creates a new builder decorating the given client. Only the queries registered with
+// WithQueryTTL are cached unless a default TTL is set. Results are stored JSON encoded, so cached queries fail with an
+// error when a column of the destination type is not carried by its JSON form, such as a field tagged json:"-".
+func NewCachedClientBuilder(client Client) CachedClientBuilder {
+	builder := &cachedClientBuilder{
+		client:   client,
+		policies: make(map[string]cachePolicy),
+	}
+
+	return builder
+}
+
+func (builder *cachedClientBuilder) WithCache(cache Cache) CachedClientBuilder {
+	builder.cache = cache
+
+	return builder
+}
+
+func (builder *cachedClientBuilder) WithDefaultTTL(ttl time.Duration) CachedClientBuilder {
+	builder.defaultTTL = ttl
+
+	return builder
+}
+
+func (builder *cachedClientBuilder) WithQueryTTL(query string, ttl time.Duration, tags ...string) CachedClientBuilder {
+	builder.policies[query] = cachePolicy{ttl: ttl, tags: tags}
+
+	return builder
+}
+
+func (builder *cachedClientBuilder) Build() (CachedClient, error) {
+	if builder.client == nil {
+		return nil, voraserror.New(nil, "cached client database client cannot be nil")
+	}
+
+	cache := builder.cache
+	if cache == nil {
+		cache = NewLRUCache(defaultLRUCapacity)
+	}
+
+	policies := make(map[string]cachePolicy, len(builder.policies))
+	for query, policy := range builder.policies {
+		policies[query] = policy
+	}
+
+	return &cachedClient{
+		client:      builder.client,
+		cache:       cache,
+		defaultTTL:  builder.defaultTTL,
+		policies:    policies,
+		generations: make(map[string]uint64),
+	}, nil
+}
+
+type cachedClient struct {
+	client     Client
+	cache      Cache
+	defaultTTL time.Duration
+	policies   map[string]cachePolicy
+	flight     flightGroup
+
+	// generations counts the invalidations of every tag, so results loaded before an invalidation are not stored
+	// after it. Stores hold the read lock and invalidations the write lock.
+	generationsMutex sync.RWMutex
+	generations      map[string]uint64
+}
+
+func (client *cachedClient) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return client.client.Exec(query, args...)
+}
+
+func (client *cachedClient) Get(dest interface{}, query string, args ...interface{}) error {
+	return client.cached(client.client.Get, dest, query, args...)
+}
+
+func (client *cachedClient) Select(dest interface{}, query string, args ...interface{}) error {
+	return client.cached(client.client.Select, dest, query, args...)
+}
+
+func (client *cachedClient) Prepare(query string) (*sql.Stmt, error) {
+	return client.client.Prepare(query)
+}
+
+func (client *cachedClient) Beginx() (*sqlx.Tx, error) {
+	return client.client.Beginx()
+}
+
+func (client *cachedClient) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return client.client.Queryx(query, args...)
+}
+
+func (client *cachedClient) InvalidateTag(tag string) {
+	client.generationsMutex.Lock()
+	client.generations[tag]++
+	client.generationsMutex.Unlock()
+
+	client.cache.InvalidateTag(tag)
+}
+
+// tagGenerations returns the current generations of the tags.
+func (client *cachedClient) tagGenerations(tags []string) []uint64 {
+	client.generationsMutex.RLock()
+	defer client.generationsMutex.RUnlock()
+
+	generations := make([]uint64, len(tags))
+	for i, tag := range tags {
+		generations[i] = client.generations[tag]
+	}
+
+	return generations
+}
+
+// store caches the encoded result unless one of its tags was invalidated since the generations were taken.
+func (client *cachedClient) store(key string, encoded []byte, policy cachePolicy, generations []uint64) {
+	client.generationsMutex.RLock()
+	defer client.generationsMutex.RUnlock()
+
+	for i, tag := range policy.tags {
+		if client.generations[tag] != generations[i] {
+			return
+		}
+	}
+
+	client.cache.Set(key, encoded, policy.ttl, policy.tags...)
+}
+
+// cached serves the query from the cache, running it at most once for concurrent identical misses.
+func (client *cachedClient) cached(load func(dest interface{}, query string, args ...interface{}) error,
+	dest interface{}, query string, args ...interface{}) error {
+	policy, ok := client.policies[query]
+	if !ok {
+		policy = cachePolicy{ttl: client.defaultTTL}
+	}
+
+	destType := reflect.TypeOf(dest)
+	if policy.ttl <= 0 || destType == nil || destType.Kind() != reflect.Ptr {
+		return load(dest, query, args...)
+	}
+
+	if err := checkRoundTrip(destType.Elem()); err != nil {
+		return err
+	}
+
+	key := cacheKey(query, args)
+
+	if value, ok := client.cache.Get(key); ok {
+		return decodeCached(value, dest)
+	}
+
+	// Callers arriving after an invalidation do not join the loads started before it.
+	generations := client.tagGenerations(policy.tags)
+
+	value, err := client.flight.do(fmt.Sprintf("%s|%v", key, generations), func() (interface{}, error) {
+		fresh := reflect.New(destType.Elem()).Interface()
+		if err := load(fresh, query, args...); err != nil {
+			return nil, err
+		}
+
+		encoded, err := json.Marshal(fresh)
+		if err != nil {
+			return nil, voraserror.New(err, "error encoding cached query result")
+		}
+
+		client.store(key, encoded, policy, generations)
+
+		return encoded, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return decodeCached(value.([]byte), dest)
+}
+
+// decodeCached decodes into a fresh value before replacing the destination, so fields left over in the destination
+// never survive a cache hit.
+func decodeCached(value []byte, dest interface{}) error {
+	fresh := reflect.New(reflect.TypeOf(dest).Elem())
+	if err := json.Unmarshal(value, fresh.Interface()); err != nil {
+		return voraserror.New(err, "error decoding cached query result")
+	}
+
+	reflect.ValueOf(dest).Elem().Set(fresh.Elem())
+
+	return nil
+}
+
+var (
+	roundTrips    sync.Map
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// checkRoundTrip returns an error if a column of the type would be lost encoding it as JSON. The result is memoized
+// per type.
+func checkRoundTrip(t reflect.Type) error {
+	if checked, ok := roundTrips.Load(t); ok {
+		err, _ := checked.(error)
+
+		return err
+	}
+
+	var err error
+	if field := lostField(t, map[reflect.Type]bool{}); field != "" {
+		err = voraserror.New(nil, fmt.Sprintf("cached query destination %s cannot be cached: field %s is not "+
+			"encoded as JSON", t, field))
+	}
+
+	roundTrips.Store(t, err)
+
+	return err
+}
+
+// lostField returns the name of the first field mapped to a column that the JSON encoding skips.
+func lostField(t reflect.Type, visited map[reflect.Type]bool) string {
+	if visited[t] || t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return ""
+	}
+
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return lostField(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if (!field.IsExported() && !field.Anonymous) || field.Tag.Get("db") == "-" {
+				continue
+			}
+
+			if field.Tag.Get("json") == "-" {
+				return t.Name() + "." + field.Name
+			}
+
+			if lost := lostField(field.Type, visited); lost != "" {
+				return lost
+			}
+		}
+	}
+
+	return ""
+}
+
+// cacheKey identifies the query with its args, encoding the type of every arg so args of different types sharing the
+// same JSON form, such as a []byte and its base64 string, get different keys.
+func cacheKey(query string, args []interface{}) string {
+	typedArgs := make([][2]interface{}, len(args))
+	for i, arg := range args {
+		typedArgs[i] = [2]interface{}{fmt.Sprintf("%T", arg), arg}
+	}
+
+	encodedArgs, err := json.Marshal(typedArgs)
+	if err != nil {
+		return fmt.Sprintf("%s|%#v", query, args)
+	}
+
+	return fmt.Sprintf("%s|%s", query, encodedArgs)
+}
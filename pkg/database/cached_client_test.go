@@ -0,0 +1,208 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+)
+
+type country struct {
+	Code string `db:"code"`
+	Name string `db:"name"`
+}
+
+func TestCachedClient_Get(t *testing.T) {
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			*dest.(*country) = country{Code: "AR", Name: "Argentina"}
+
+			return nil
+		},
+	}
+
+	const query = "SELECT code, name FROM countries WHERE code = ?"
+
+	cached, err := database.NewCachedClientBuilder(client).
+		WithQueryTTL(query, time.Minute, "countries").
+		Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	for i := 0; i < 3; i++ {
+		got := country{}
+
+		err = cached.Get(&got, query, "AR")
+		assert.Nil(t, err, "Unexpected error getting country")
+		assert.Equal(t, country{Code: "AR", Name: "Argentina"}, got, "Country is not the expected")
+	}
+
+	assert.Len(t, client.queries, 1, "Query should be executed once")
+
+	cached.InvalidateTag("countries")
+
+	err = cached.Get(&country{}, query, "AR")
+	assert.Nil(t, err, "Unexpected error getting country")
+	assert.Len(t, client.queries, 2, "Query should be executed again after the invalidation")
+}
+
+func TestCachedClient_Get_InvalidatedWhileLoading(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			if loading != nil {
+				close(loading)
+				<-release
+			}
+
+			*dest.(*country) = country{Code: "AR", Name: "Argentina"}
+
+			return nil
+		},
+	}
+
+	const query = "SELECT code, name FROM countries WHERE code = ?"
+
+	cached, err := database.NewCachedClientBuilder(client).
+		WithQueryTTL(query, time.Minute, "countries").
+		Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	done := make(chan error)
+	go func() {
+		done <- cached.Get(&country{}, query, "AR")
+	}()
+
+	<-loading
+	cached.InvalidateTag("countries")
+	loading = nil
+	close(release)
+	assert.Nil(t, <-done, "Unexpected error getting country")
+
+	err = cached.Get(&country{}, query, "AR")
+	assert.Nil(t, err, "Unexpected error getting country")
+	assert.Len(t, client.queries, 2, "Result loaded before the invalidation should not be cached")
+}
+
+func TestCachedClient_Get_ArgsOfDifferentTypes(t *testing.T) {
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			*dest.(*country) = country{Code: "AR", Name: "Argentina"}
+
+			return nil
+		},
+	}
+
+	cached, err := database.NewCachedClientBuilder(client).WithDefaultTTL(time.Minute).Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	_ = cached.Get(&country{}, "SELECT * FROM countries WHERE code = ?", []byte("AR"))
+	_ = cached.Get(&country{}, "SELECT * FROM countries WHERE code = ?", "QVI=")
+
+	assert.Len(t, client.queries, 2, "Args with the same JSON form but different types should not share results")
+}
+
+func TestCachedClient_Get_FieldsNotEncodedAsJSON(t *testing.T) {
+	type account struct {
+		ID           int64  `db:"id"`
+		PasswordHash string `db:"password_hash" json:"-"`
+	}
+
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			*dest.(*account) = account{ID: 1, PasswordHash: "hash"}
+
+			return nil
+		},
+	}
+
+	cached, err := database.NewCachedClientBuilder(client).WithDefaultTTL(time.Minute).Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	for i := 0; i < 2; i++ {
+		got := account{}
+
+		err = cached.Get(&got, "SELECT * FROM accounts WHERE id = ?", 1)
+		assert.NotNil(t, err, "Destination losing columns in JSON should be rejected")
+		assert.Equal(t, account{}, got, "Destination should be left untouched")
+	}
+
+	assert.Empty(t, client.queries, "Query should not be executed")
+}
+
+func TestCachedClient_Select_ReplacesDestination(t *testing.T) {
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			*dest.(*[]country) = []country{{Code: "AR", Name: "Argentina"}}
+
+			return nil
+		},
+	}
+
+	cached, err := database.NewCachedClientBuilder(client).WithDefaultTTL(time.Minute).Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	for i := 0; i < 2; i++ {
+		got := []country{{Code: "UY", Name: "Uruguay"}, {Code: "CL", Name: "Chile"}}
+
+		err = cached.Select(&got, "SELECT * FROM countries")
+		assert.Nil(t, err, "Unexpected error selecting countries")
+		assert.Equal(t, []country{{Code: "AR", Name: "Argentina"}}, got, "Countries are not the expected")
+	}
+}
+
+func TestCachedClient_Get_NotRegisteredQuery(t *testing.T) {
+	client := &fakeClient{}
+
+	cached, err := database.NewCachedClientBuilder(client).Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	_ = cached.Get(&country{}, "SELECT * FROM countries", "AR")
+	_ = cached.Get(&country{}, "SELECT * FROM countries", "AR")
+
+	assert.Len(t, client.queries, 2, "Not registered queries should not be cached")
+}
+
+func TestCachedClient_Get_ErrorIsNotCached(t *testing.T) {
+	client := &fakeClient{err: errors.New("sql: no rows in result set")}
+
+	cached, err := database.NewCachedClientBuilder(client).WithDefaultTTL(time.Minute).Build()
+	assert.Nil(t, err, "Unexpected error building cached client")
+
+	err = cached.Get(&country{}, "SELECT * FROM countries", "XX")
+	assert.Equal(t, client.err, err, "Error is not the expected")
+
+	_ = cached.Get(&country{}, "SELECT * FROM countries", "XX")
+	assert.Len(t, client.queries, 2, "Errors should not be cached")
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := database.NewLRUCache(2)
+
+	cache.Set("a", []byte("1"), time.Minute)
+	cache.Set("b", []byte("2"), time.Minute, "tag")
+	_, _ = cache.Get("a")
+	cache.Set("c", []byte("3"), time.Minute, "tag")
+
+	_, ok := cache.Get("b")
+	assert.False(t, ok, "Least recently used entry should be evicted")
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok, "Recently used entry should be kept")
+	assert.Equal(t, []byte("1"), value, "Value is not the expected")
+
+	cache.InvalidateTag("tag")
+
+	_, ok = cache.Get("c")
+	assert.False(t, ok, "Tagged entry should be invalidated")
+
+	cache.Set("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	_, ok = cache.Get("d")
+	assert.False(t, ok, "Expired entry should not be returned")
+}
@@ -0,0 +1,402 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultBreakerFailureRate      = 0.5
+	defaultBreakerSlowCallRate     = 1.0
+	defaultBreakerMinRequests      = 20
+	defaultBreakerWindow           = 10 * time.Second
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 3
+)
+
+var errBreakerCallPanicked = errors.New("database call panicked")
+
+// BreakerState the state of a circuit breaker.
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// UnavailableError the error returned without reaching the database while the circuit breaker rejects calls.
+type UnavailableError struct {
+	State      BreakerState
+	RetryAfter time.Duration
+}
+
+func (err *UnavailableError) Error() string {
+	return fmt.Sprintf("database unavailable: circuit breaker is %s", err.State)
+}
+
+// IsUnavailableError returns true if the error was returned by an open circuit breaker.
+func IsUnavailableError(err error) bool {
+	var unavailable *UnavailableError
+
+	return errors.As(err, &unavailable)
+}
+
+// CircuitBreakerBuilder the database circuit breaker builder interface.
+type CircuitBreakerBuilder interface {
+	WithFailureRate(rate float64) CircuitBreakerBuilder
+	WithSlowCalls(threshold time.Duration, rate float64) CircuitBreakerBuilder
+	WithMinRequests(minRequests int) CircuitBreakerBuilder
+	WithWindow(window time.Duration) CircuitBreakerBuilder
+	WithOpenTimeout(openTimeout time.Duration) CircuitBreakerBuilder
+	WithHalfOpenRequests(halfOpenRequests int) CircuitBreakerBuilder
+	WithLogger(logger log.ILogger) CircuitBreakerBuilder
+	Build() (Client, error)
+}
+
+// circuitBreakerBuilder the database circuit breaker builder.
+type circuitBreakerBuilder struct {
+	client           Client
+	failureRate      float64
+	slowCallDuration time.Duration
+	slowCallRate     float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenRequests int
+	logger           log.ILogger
+}
+
+// NewCircuitBreakerBuilder creates a new builder decorating the given client with a circuit breaker.
+// Slow calls are not tracked unless a threshold is set with WithSlowCalls.
+func NewCircuitBreakerBuilder(client Client) CircuitBreakerBuilder {
+	builder := &circuitBreakerBuilder{
+		client:           client,
+		failureRate:      defaultBreakerFailureRate,
+		slowCallRate:     defaultBreakerSlowCallRate,
+		minRequests:      defaultBreakerMinRequests,
+		window:           defaultBreakerWindow,
+		openTimeout:      defaultBreakerOpenTimeout,
+		halfOpenRequests: defaultBreakerHalfOpenRequests,
+		logger:           log.DefaultLogger(),
+	}
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithFailureRate(rate float64) CircuitBreakerBuilder {
+	builder.failureRate = rate
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithSlowCalls(threshold time.Duration, rate float64) CircuitBreakerBuilder {
+	builder.slowCallDuration = threshold
+	builder.slowCallRate = rate
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithMinRequests(minRequests int) CircuitBreakerBuilder {
+	builder.minRequests = minRequests
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithWindow(window time.Duration) CircuitBreakerBuilder {
+	builder.window = window
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithOpenTimeout(openTimeout time.Duration) CircuitBreakerBuilder {
+	builder.openTimeout = openTimeout
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithHalfOpenRequests(halfOpenRequests int) CircuitBreakerBuilder {
+	builder.halfOpenRequests = halfOpenRequests
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) WithLogger(logger log.ILogger) CircuitBreakerBuilder {
+	builder.logger = logger
+
+	return builder
+}
+
+func (builder *circuitBreakerBuilder) Build() (Client, error) {
+	if builder.client == nil {
+		return nil, voraserror.New(nil, "circuit breaker database client cannot be nil")
+	}
+
+	if builder.failureRate <= 0 || builder.failureRate > 1 {
+		return nil, voraserror.New(nil, "circuit breaker failure rate must be between 0 and 1")
+	}
+
+	if builder.slowCallDuration < 0 || builder.slowCallRate <= 0 || builder.slowCallRate > 1 {
+		return nil, voraserror.New(nil, "circuit breaker slow calls configuration is not valid")
+	}
+
+	if builder.minRequests < 1 {
+		return nil, voraserror.New(nil, "circuit breaker min requests must be greater than zero")
+	}
+
+	if builder.window <= 0 {
+		return nil, voraserror.New(nil, "circuit breaker window must be greater than zero")
+	}
+
+	if builder.openTimeout <= 0 {
+		return nil, voraserror.New(nil, "circuit breaker open timeout must be greater than zero")
+	}
+
+	if builder.halfOpenRequests < 1 {
+		return nil, voraserror.New(nil, "circuit breaker half-open requests must be greater than zero")
+	}
+
+	if builder.logger == nil {
+		return nil, voraserror.New(nil, "circuit breaker logger cannot be nil")
+	}
+
+	breaker := &circuitBreaker{
+		client:           builder.client,
+		failureRate:      builder.failureRate,
+		slowCallDuration: builder.slowCallDuration,
+		slowCallRate:     builder.slowCallRate,
+		minRequests:      builder.minRequests,
+		window:           builder.window,
+		openTimeout:      builder.openTimeout,
+		halfOpenRequests: builder.halfOpenRequests,
+		logger:           builder.logger,
+		now:              time.Now,
+		state:            BreakerClosed,
+	}
+	breaker.windowStart = breaker.now()
+
+	return breaker, nil
+}
+
+type circuitBreaker struct {
+	client           Client
+	failureRate      float64
+	slowCallDuration time.Duration
+	slowCallRate     float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenRequests int
+	logger           log.ILogger
+	now              func() time.Time
+
+	mutex       sync.Mutex
+	state       BreakerState
+	generation  uint64
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	slowCalls   int
+	inFlight    int
+	successes   int
+}
+
+func (breaker *circuitBreaker) Exec(query string, args ...interface{}) (result sql.Result, err error) {
+	err = breaker.call(func() error {
+		result, err = breaker.client.Exec(query, args...)
+
+		return err
+	})
+
+	return result, err
+}
+
+func (breaker *circuitBreaker) Get(dest interface{}, query string, args ...interface{}) error {
+	return breaker.call(func() error {
+		return breaker.client.Get(dest, query, args...)
+	})
+}
+
+func (breaker *circuitBreaker) Select(dest interface{}, query string, args ...interface{}) error {
+	return breaker.call(func() error {
+		return breaker.client.Select(dest, query, args...)
+	})
+}
+
+func (breaker *circuitBreaker) Prepare(query string) (stmt *sql.Stmt, err error) {
+	err = breaker.call(func() error {
+		stmt, err = breaker.client.Prepare(query)
+
+		return err
+	})
+
+	return stmt, err
+}
+
+func (breaker *circuitBreaker) Beginx() (tx *sqlx.Tx, err error) {
+	err = breaker.call(func() error {
+		tx, err = breaker.client.Beginx()
+
+		return err
+	})
+
+	return tx, err
+}
+
+func (breaker *circuitBreaker) Queryx(query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = breaker.call(func() error {
+		rows, err = breaker.client.Queryx(query, args...)
+
+		return err
+	})
+
+	return rows, err
+}
+
+// call runs fn if the breaker allows it and records its outcome. A panic is recorded as a failure before it goes on,
+// so a half-open probe never keeps its slot.
+func (breaker *circuitBreaker) call(fn func() error) error {
+	generation, err := breaker.allow()
+	if err != nil {
+		return err
+	}
+
+	start := breaker.now()
+	completed := false
+
+	defer func() {
+		if !completed {
+			breaker.record(generation, errBreakerCallPanicked, breaker.now().Sub(start))
+		}
+	}()
+
+	err = fn()
+	completed = true
+
+	breaker.record(generation, err, breaker.now().Sub(start))
+
+	return err
+}
+
+// allow returns the generation the call belongs to, or an UnavailableError if the call must be rejected.
+func (breaker *circuitBreaker) allow() (uint64, error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	now := breaker.now()
+
+	switch breaker.state {
+	case BreakerOpen:
+		retryAfter := breaker.openedAt.Add(breaker.openTimeout).Sub(now)
+		if retryAfter > 0 {
+			return 0, &UnavailableError{State: BreakerOpen, RetryAfter: retryAfter}
+		}
+
+		breaker.transition(BreakerHalfOpen, now)
+	case BreakerClosed:
+		if now.Sub(breaker.windowStart) >= breaker.window {
+			breaker.resetCounts(now)
+		}
+	}
+
+	if breaker.state == BreakerHalfOpen {
+		if breaker.inFlight >= breaker.halfOpenRequests {
+			return 0, &UnavailableError{State: BreakerHalfOpen}
+		}
+
+		breaker.inFlight++
+	}
+
+	return breaker.generation, nil
+}
+
+// record updates the breaker with the outcome of a call. Calls started before the last transition are ignored.
+func (breaker *circuitBreaker) record(generation uint64, err error, duration time.Duration) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if generation != breaker.generation {
+		return
+	}
+
+	now := breaker.now()
+	failed := err != nil && !IsNoRowsError(err)
+	slow := breaker.slowCallDuration > 0 && duration >= breaker.slowCallDuration
+
+	switch breaker.state {
+	case BreakerHalfOpen:
+		breaker.inFlight--
+
+		if failed || slow {
+			breaker.transition(BreakerOpen, now)
+
+			return
+		}
+
+		breaker.successes++
+		if breaker.successes >= breaker.halfOpenRequests {
+			breaker.transition(BreakerClosed, now)
+		}
+	case BreakerClosed:
+		breaker.requests++
+
+		if failed {
+			breaker.failures++
+		}
+
+		if slow {
+			breaker.slowCalls++
+		}
+
+		if breaker.requests < breaker.minRequests {
+			return
+		}
+
+		requests := float64(breaker.requests)
+		if float64(breaker.failures)/requests >= breaker.failureRate ||
+			(breaker.slowCallDuration > 0 && float64(breaker.slowCalls)/requests >= breaker.slowCallRate) {
+			breaker.transition(BreakerOpen, now)
+		}
+	}
+}
+
+// transition moves the breaker to the given state. The mutex must be held.
+func (breaker *circuitBreaker) transition(state BreakerState, now time.Time) {
+	from := breaker.state
+
+	breaker.state = state
+	breaker.generation++
+	breaker.inFlight = 0
+	breaker.successes = 0
+	breaker.resetCounts(now)
+
+	if state == BreakerOpen {
+		breaker.openedAt = now
+	}
+
+	tags := map[string]string{"from": string(from), "to": string(state)}
+
+	if state == BreakerClosed {
+		breaker.logger.Info(breaker, tags, "Database circuit breaker state changed from %s to %s", from, state)
+
+		return
+	}
+
+	breaker.logger.Warn(breaker, tags, "Database circuit breaker state changed from %s to %s", from, state)
+}
+
+func (breaker *circuitBreaker) resetCounts(now time.Time) {
+	breaker.windowStart = now
+	breaker.requests = 0
+	breaker.failures = 0
+	breaker.slowCalls = 0
+}
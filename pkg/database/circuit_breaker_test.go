@@ -0,0 +1,258 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+	voraserrors "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	client := &fakeClient{err: errors.New("connection refused")}
+
+	breaker, err := database.NewCircuitBreakerBuilder(client).
+		WithMinRequests(2).
+		WithFailureRate(0.5).
+		WithOpenTimeout(20 * time.Millisecond).
+		WithHalfOpenRequests(1).
+		Build()
+	assert.Nil(t, err, "Unexpected error building circuit breaker")
+
+	for i := 0; i < 2; i++ {
+		_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+		assert.Equal(t, client.err, err, "Error is not the expected while closed")
+	}
+
+	_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+	assert.True(t, database.IsUnavailableError(err), "Breaker should fail fast while open")
+	assert.Len(t, client.queries, 2, "Database should not be reached while open")
+
+	time.Sleep(30 * time.Millisecond)
+
+	client.err = nil
+
+	_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+	assert.Nil(t, err, "Half-open probe should reach the database")
+
+	_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+	assert.Nil(t, err, "Breaker should be closed after a successful probe")
+	assert.Len(t, client.queries, 4, "Database should be reached once closed")
+}
+
+func TestCircuitBreaker_NoRowsIsNotAFailure(t *testing.T) {
+	client := &fakeClient{err: errors.New("sql: no rows in result set")}
+
+	breaker, err := database.NewCircuitBreakerBuilder(client).WithMinRequests(1).Build()
+	assert.Nil(t, err, "Unexpected error building circuit breaker")
+
+	for i := 0; i < 3; i++ {
+		err = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+		assert.True(t, database.IsNoRowsError(err), "No rows error should be returned")
+	}
+}
+
+func TestCircuitBreaker_SlowCalls(t *testing.T) {
+	client := &fakeClient{
+		get: func(dest interface{}) error {
+			time.Sleep(10 * time.Millisecond)
+
+			return nil
+		},
+	}
+
+	breaker, err := database.NewCircuitBreakerBuilder(client).
+		WithMinRequests(2).
+		WithSlowCalls(5*time.Millisecond, 0.5).
+		Build()
+	assert.Nil(t, err, "Unexpected error building circuit breaker")
+
+	for i := 0; i < 2; i++ {
+		err = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+		assert.Nil(t, err, "Slow calls should succeed")
+	}
+
+	err = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+	assert.True(t, database.IsUnavailableError(err), "Breaker should open after too many slow calls")
+}
+
+func TestCircuitBreaker_WindowReset(t *testing.T) {
+	client := &fakeClient{err: errors.New("connection refused")}
+
+	breaker, err := database.NewCircuitBreakerBuilder(client).
+		WithMinRequests(2).
+		WithFailureRate(0.5).
+		WithWindow(20 * time.Millisecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building circuit breaker")
+
+	_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+	assert.Equal(t, client.err, err, "Error is not the expected")
+
+	time.Sleep(30 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+		assert.Equal(t, client.err, err, "Failures of a previous window should not open the breaker")
+	}
+
+	_, err = breaker.Exec("UPDATE users SET name = ?", "John")
+	assert.True(t, database.IsUnavailableError(err), "Breaker should open after failures in the same window")
+}
+
+func TestCircuitBreaker_PanickingProbe(t *testing.T) {
+	client := &fakeClient{err: errors.New("connection refused")}
+
+	breaker, err := database.NewCircuitBreakerBuilder(client).
+		WithMinRequests(1).
+		WithOpenTimeout(10 * time.Millisecond).
+		WithHalfOpenRequests(1).
+		Build()
+	assert.Nil(t, err, "Unexpected error building circuit breaker")
+
+	_ = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+
+	time.Sleep(20 * time.Millisecond)
+
+	client.err = nil
+	client.get = func(dest interface{}) error {
+		panic("scan failed")
+	}
+
+	assert.Panics(t, func() {
+		_ = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+	}, "Panic should reach the caller")
+
+	time.Sleep(20 * time.Millisecond)
+
+	client.get = nil
+
+	err = breaker.Get(&struct{}{}, "SELECT * FROM users WHERE id = ?", 1)
+	assert.Nil(t, err, "Breaker should allow a new probe after a panicking one")
+}
+
+func Test_circuitBreakerBuilder_Build(t *testing.T) {
+	type fields struct {
+		client            database.Client
+		failureRate       float64
+		slowCallThreshold time.Duration
+		slowCallRate      float64
+		minRequests       int
+		window            time.Duration
+		openTimeout       time.Duration
+		halfOpenRequests  int
+		logger            log.ILogger
+	}
+
+	valid := func(change func(fields *fields)) fields {
+		theFields := fields{
+			client:           &fakeClient{},
+			failureRate:      0.5,
+			slowCallRate:     1,
+			minRequests:      20,
+			window:           10 * time.Second,
+			openTimeout:      30 * time.Second,
+			halfOpenRequests: 3,
+			logger:           log.DefaultLogger(),
+		}
+
+		change(&theFields)
+
+		return theFields
+	}
+
+	tests := []struct {
+		name      string
+		fields    fields
+		wantedErr error
+	}{
+		{
+			name:   "Circuit breaker is successfully created",
+			fields: valid(func(fields *fields) {}),
+		},
+		{
+			name: "Circuit breaker is successfully created tracking slow calls",
+			fields: valid(func(fields *fields) {
+				fields.slowCallThreshold = time.Second
+				fields.slowCallRate = 0.5
+			}),
+		},
+		{
+			name:      "Circuit breaker is not created when the client is nil",
+			fields:    valid(func(fields *fields) { fields.client = nil }),
+			wantedErr: voraserrors.New(nil, "circuit breaker database client cannot be nil"),
+		},
+		{
+			name:      "Circuit breaker is not created when the failure rate is zero",
+			fields:    valid(func(fields *fields) { fields.failureRate = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker failure rate must be between 0 and 1"),
+		},
+		{
+			name:      "Circuit breaker is not created when the failure rate is greater than one",
+			fields:    valid(func(fields *fields) { fields.failureRate = 1.5 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker failure rate must be between 0 and 1"),
+		},
+		{
+			name:      "Circuit breaker is not created when the slow call threshold is negative",
+			fields:    valid(func(fields *fields) { fields.slowCallThreshold = -time.Second }),
+			wantedErr: voraserrors.New(nil, "circuit breaker slow calls configuration is not valid"),
+		},
+		{
+			name:      "Circuit breaker is not created when the slow call rate is zero",
+			fields:    valid(func(fields *fields) { fields.slowCallRate = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker slow calls configuration is not valid"),
+		},
+		{
+			name:      "Circuit breaker is not created when the min requests is zero",
+			fields:    valid(func(fields *fields) { fields.minRequests = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker min requests must be greater than zero"),
+		},
+		{
+			name:      "Circuit breaker is not created when the window is zero",
+			fields:    valid(func(fields *fields) { fields.window = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker window must be greater than zero"),
+		},
+		{
+			name:      "Circuit breaker is not created when the open timeout is zero",
+			fields:    valid(func(fields *fields) { fields.openTimeout = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker open timeout must be greater than zero"),
+		},
+		{
+			name:      "Circuit breaker is not created when the half-open requests is zero",
+			fields:    valid(func(fields *fields) { fields.halfOpenRequests = 0 }),
+			wantedErr: voraserrors.New(nil, "circuit breaker half-open requests must be greater than zero"),
+		},
+		{
+			name:      "Circuit breaker is not created when the logger is nil",
+			fields:    valid(func(fields *fields) { fields.logger = nil }),
+			wantedErr: voraserrors.New(nil, "circuit breaker logger cannot be nil"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.NewCircuitBreakerBuilder(tt.fields.client).
+				WithFailureRate(tt.fields.failureRate).
+				WithSlowCalls(tt.fields.slowCallThreshold, tt.fields.slowCallRate).
+				WithMinRequests(tt.fields.minRequests).
+				WithWindow(tt.fields.window).
+				WithOpenTimeout(tt.fields.openTimeout).
+				WithHalfOpenRequests(tt.fields.halfOpenRequests).
+				WithLogger(tt.fields.logger).
+				Build()
+
+			if tt.wantedErr != nil {
+				assert.Equal(t, tt.wantedErr, err, "Error is not the expected building circuit breaker")
+
+				return
+			}
+
+			assert.Nil(t, err, "Unexpected error building circuit breaker")
+			assert.NotNil(t, got, "Circuit breaker should be not nil")
+		})
+	}
+}
@@ -15,7 +15,7 @@ func IsNoRowsError(err error) bool {
 }
 
 func FinishTransaction(ctx context.Context, tx *sqlx.Tx, err error) {
-	logger := log.DefaultLogger()
+	logger := log.FromContext(ctx)
 
 	if err != nil {
 		if err = tx.Rollback(); err != nil {
@@ -0,0 +1,486 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultJobTable          = "jobs"
+	defaultJobQueue          = "default"
+	defaultJobConcurrency    = 1
+	defaultJobMaxAttempts    = 5
+	defaultJobPollInterval   = time.Second
+	defaultJobBackoffBase    = time.Second
+	defaultJobBackoffMax     = 10 * time.Minute
+	defaultVisibilityTimeout = 5 * time.Minute
+
+	jobColumns = "id, queue, payload, priority, run_at, attempts, max_attempts, status, locked_until, last_error, " +
+		"created_at, updated_at"
+	enqueueJobQuery = "INSERT INTO %s (queue, payload, priority, run_at, attempts, max_attempts, status, created_at, " +
+		"updated_at) VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?)"
+	claimJobQuery = "SELECT " + jobColumns + " FROM %s WHERE queue = ? AND " +
+		"((status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ? AND attempts < max_attempts)) " +
+		"ORDER BY priority DESC, run_at ASC LIMIT 1 FOR UPDATE SKIP LOCKED"
+	failExpiredJobsQuery = "UPDATE %s SET status = ?, locked_until = NULL, last_error = ?, updated_at = ? " +
+		"WHERE queue = ? AND status = ? AND locked_until <= ? AND attempts >= max_attempts"
+	lockJobQuery = "UPDATE %s SET status = ?, attempts = attempts + 1, locked_until = ?, updated_at = ? " +
+		"WHERE id = ?"
+	completeJobQuery = "UPDATE %s SET status = ?, locked_until = NULL, last_error = NULL, updated_at = ? " +
+		"WHERE id = ? AND status = ? AND locked_until = ?"
+	retryJobQuery = "UPDATE %s SET status = ?, run_at = ?, locked_until = NULL, last_error = ?, updated_at = ? " +
+		"WHERE id = ? AND status = ? AND locked_until = ?"
+
+	expiredJobError = "visibility timeout expired on the last attempt"
+)
+
+// JobStatus the status of a job stored in the queue table.
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// Job a background job stored in the queue table.
+type Job struct {
+	ID          int64          `db:"id"`
+	Queue       string         `db:"queue"`
+	Payload     []byte         `db:"payload"`
+	Priority    int            `db:"priority"`
+	RunAt       time.Time      `db:"run_at"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	Status      JobStatus      `db:"status"`
+	LockedUntil sql.NullTime   `db:"locked_until"`
+	LastError   sql.NullString `db:"last_error"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+}
+
+// JobHandler processes a claimed job. Returning an error schedules a retry until the job runs out of attempts.
+type JobHandler func(ctx context.Context, job *Job) error
+
+// JobQueue the database backed job queue interface.
+type JobQueue interface {
+	// Enqueue stores a new pending job and returns its ID. A zero RunAt means the job can run immediately.
+	Enqueue(job *Job) (int64, error)
+	// Run claims and processes jobs until the context is cancelled, then waits for in-flight jobs to finish.
+	Run(ctx context.Context, handler JobHandler) error
+}
+
+// JobQueueBuilder the database job queue builder interface.
+type JobQueueBuilder interface {
+	WithTable(table string) JobQueueBuilder
+	WithQueue(queue string) JobQueueBuilder
+	WithConcurrency(concurrency int) JobQueueBuilder
+	WithMaxAttempts(maxAttempts int) JobQueueBuilder
+	WithPollInterval(pollInterval time.Duration) JobQueueBuilder
+	WithBackoff(base, max time.Duration) JobQueueBuilder
+	WithVisibilityTimeout(visibilityTimeout time.Duration) JobQueueBuilder
+	WithLogger(logger log.ILogger) JobQueueBuilder
+	Build() (JobQueue, error)
+}
+
+// jobQueueBuilder the database job queue builder.
+type jobQueueBuilder struct {
+	client            Client
+	table             string
+	queue             string
+	concurrency       int
+	maxAttempts       int
+	pollInterval      time.Duration
+	backoffBase       time.Duration
+	backoffMax        time.Duration
+	visibilityTimeout time.Duration
+	logger            log.ILogger
+}
+
+// NewJobQueueBuilder creates a new job queue builder with default settings.
+//
+// The queue table is expected to have the following shape (MySQL 8 is required for SKIP LOCKED):
+//
+//	CREATE TABLE jobs (
+//	  id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+//	  queue        VARCHAR(64)  NOT NULL,
+//	  payload      BLOB         NOT NULL,
+//	  priority     INT          NOT NULL DEFAULT 0,
+//	  run_at       DATETIME(6)  NOT NULL,
+//	  attempts     INT          NOT NULL DEFAULT 0,
+//	  max_attempts INT          NOT NULL,
+//	  status       VARCHAR(16)  NOT NULL,
+//	  locked_until DATETIME(6)  NULL,
+//	  last_error   TEXT         NULL,
+//	  created_at   DATETIME(6)  NOT NULL,
+//	  updated_at   DATETIME(6)  NOT NULL,
+//	  INDEX idx_jobs_claim (queue, status, priority, run_at)
+//	);
+func NewJobQueueBuilder(client Client) JobQueueBuilder {
+	builder := &jobQueueBuilder{
+		client:            client,
+		table:             defaultJobTable,
+		queue:             defaultJobQueue,
+		concurrency:       defaultJobConcurrency,
+		maxAttempts:       defaultJobMaxAttempts,
+		pollInterval:      defaultJobPollInterval,
+		backoffBase:       defaultJobBackoffBase,
+		backoffMax:        defaultJobBackoffMax,
+		visibilityTimeout: defaultVisibilityTimeout,
+		logger:            log.DefaultLogger(),
+	}
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithTable(table string) JobQueueBuilder {
+	builder.table = table
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithQueue(queue string) JobQueueBuilder {
+	builder.queue = queue
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithConcurrency(concurrency int) JobQueueBuilder {
+	builder.concurrency = concurrency
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithMaxAttempts(maxAttempts int) JobQueueBuilder {
+	builder.maxAttempts = maxAttempts
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithPollInterval(pollInterval time.Duration) JobQueueBuilder {
+	builder.pollInterval = pollInterval
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithBackoff(base, max time.Duration) JobQueueBuilder {
+	builder.backoffBase = base
+	builder.backoffMax = max
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithVisibilityTimeout(visibilityTimeout time.Duration) JobQueueBuilder {
+	builder.visibilityTimeout = visibilityTimeout
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) WithLogger(logger log.ILogger) JobQueueBuilder {
+	builder.logger = logger
+
+	return builder
+}
+
+func (builder *jobQueueBuilder) Build() (JobQueue, error) {
+	if builder.client == nil {
+		return nil, voraserror.New(nil, "job queue database client cannot be nil")
+	}
+
+	if builder.table == "" {
+		return nil, voraserror.New(nil, "job queue table cannot be empty")
+	}
+
+	if !IsValidIdentifier(builder.table) {
+		return nil, voraserror.New(nil, fmt.Sprintf("job queue table %q is not valid", builder.table))
+	}
+
+	if builder.queue == "" {
+		return nil, voraserror.New(nil, "job queue name cannot be empty")
+	}
+
+	if builder.concurrency < 1 {
+		return nil, voraserror.New(nil, "job queue concurrency must be greater than zero")
+	}
+
+	if builder.maxAttempts < 1 {
+		return nil, voraserror.New(nil, "job queue max attempts must be greater than zero")
+	}
+
+	if builder.pollInterval <= 0 {
+		return nil, voraserror.New(nil, "job queue poll interval must be greater than zero")
+	}
+
+	if builder.backoffBase <= 0 || builder.backoffMax < builder.backoffBase {
+		return nil, voraserror.New(nil, "job queue backoff is not valid")
+	}
+
+	if builder.visibilityTimeout <= 0 {
+		return nil, voraserror.New(nil, "job queue visibility timeout must be greater than zero")
+	}
+
+	if builder.logger == nil {
+		return nil, voraserror.New(nil, "job queue logger cannot be nil")
+	}
+
+	return &jobQueue{
+		client:            builder.client,
+		table:             builder.table,
+		queue:             builder.queue,
+		concurrency:       builder.concurrency,
+		maxAttempts:       builder.maxAttempts,
+		pollInterval:      builder.pollInterval,
+		backoffBase:       builder.backoffBase,
+		backoffMax:        builder.backoffMax,
+		visibilityTimeout: builder.visibilityTimeout,
+		logger:            builder.logger,
+		now:               time.Now,
+	}, nil
+}
+
+type jobQueue struct {
+	client            Client
+	table             string
+	queue             string
+	concurrency       int
+	maxAttempts       int
+	pollInterval      time.Duration
+	backoffBase       time.Duration
+	backoffMax        time.Duration
+	visibilityTimeout time.Duration
+	logger            log.ILogger
+	now               func() time.Time
+}
+
+func (queue *jobQueue) Enqueue(job *Job) (int64, error) {
+	if job == nil {
+		return 0, voraserror.New(nil, "job cannot be nil")
+	}
+
+	now := queue.now().UTC()
+
+	runAt := job.RunAt
+	if runAt.IsZero() {
+		runAt = now
+	}
+
+	maxAttempts := job.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = queue.maxAttempts
+	}
+
+	result, err := queue.client.Exec(fmt.Sprintf(enqueueJobQuery, queue.table), queue.queue, job.Payload,
+		job.Priority, runAt.UTC(), maxAttempts, JobStatusPending, now, now)
+	if err != nil {
+		return 0, voraserror.New(err, "error enqueueing job")
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, voraserror.New(err, "error reading enqueued job id")
+	}
+
+	return id, nil
+}
+
+func (queue *jobQueue) Run(ctx context.Context, handler JobHandler) error {
+	if handler == nil {
+		return voraserror.New(nil, "job handler cannot be nil")
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < queue.concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			queue.work(ctx, handler)
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// work claims jobs one by one until the context is cancelled, sleeping for the poll interval when the queue is empty.
+func (queue *jobQueue) work(ctx context.Context, handler JobHandler) {
+	for ctx.Err() == nil {
+		job, err := queue.claim(ctx)
+		if err != nil {
+			queue.logger.Error(queue, map[string]string{"queue": queue.queue}, err, "Error claiming job")
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(queue.pollInterval):
+			}
+
+			continue
+		}
+
+		queue.process(ctx, handler, job)
+	}
+}
+
+// claim locks the next runnable job, including running jobs whose visibility timeout elapsed because their worker
+// crashed and that still have attempts left. Expired jobs without attempts left are moved to failed first. It returns
+// nil when there is nothing to run.
+func (queue *jobQueue) claim(ctx context.Context) (job *Job, err error) {
+	// Lock times are stored with microsecond precision and later compared for equality, so they are truncated here.
+	now := queue.now().UTC().Truncate(time.Microsecond)
+
+	if _, err = queue.client.Exec(fmt.Sprintf(failExpiredJobsQuery, queue.table), JobStatusFailed, expiredJobError,
+		now, queue.queue, JobStatusRunning, now); err != nil {
+		return nil, err
+	}
+
+	tx, err := queue.client.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		FinishTransaction(ctx, tx, err)
+	}()
+
+	claimed := &Job{}
+
+	err = tx.Get(claimed, fmt.Sprintf(claimJobQuery, queue.table), queue.queue, JobStatusPending, now,
+		JobStatusRunning, now)
+	if err != nil {
+		if IsNoRowsError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	lockedUntil := now.Add(queue.visibilityTimeout).Truncate(time.Microsecond)
+
+	if _, err = tx.Exec(fmt.Sprintf(lockJobQuery, queue.table), JobStatusRunning, lockedUntil, now,
+		claimed.ID); err != nil {
+		return nil, err
+	}
+
+	claimed.Status = JobStatusRunning
+	claimed.Attempts++
+	claimed.LockedUntil = sql.NullTime{Time: lockedUntil, Valid: true}
+
+	return claimed, nil
+}
+
+// process runs the handler for a claimed job. The handler context is not cancelled on shutdown so in-flight jobs can
+// finish, but it is bounded by the visibility timeout after which another worker may claim the job again.
+func (queue *jobQueue) process(ctx context.Context, handler JobHandler, job *Job) {
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), queue.visibilityTimeout)
+	defer cancel()
+
+	tags := map[string]string{"queue": queue.queue, "job_id": fmt.Sprint(job.ID), "attempt": fmt.Sprint(job.Attempts)}
+
+	handlerErr := runJobHandler(jobCtx, handler, job)
+	if handlerErr == nil {
+		if err := queue.complete(job); err != nil {
+			queue.logger.Error(queue, tags, err, "Error completing job")
+		}
+
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		queue.logger.Error(queue, tags, handlerErr, "Job failed permanently")
+	} else {
+		queue.logger.Warn(queue, tags, "Job failed, scheduling retry: %v", handlerErr)
+	}
+
+	if err := queue.retry(job, handlerErr); err != nil {
+		queue.logger.Error(queue, tags, err, "Error rescheduling job")
+	}
+}
+
+// complete marks the job as done. It fails when the job lock was lost, as another worker may have claimed it again.
+func (queue *jobQueue) complete(job *Job) error {
+	result, err := queue.client.Exec(fmt.Sprintf(completeJobQuery, queue.table), JobStatusDone, queue.now().UTC(),
+		job.ID, JobStatusRunning, job.LockedUntil.Time)
+	if err != nil {
+		return err
+	}
+
+	return checkJobLock(result)
+}
+
+func (queue *jobQueue) retry(job *Job, handlerErr error) error {
+	now := queue.now().UTC()
+	status := JobStatusPending
+
+	if job.Attempts >= job.MaxAttempts {
+		status = JobStatusFailed
+	}
+
+	runAt := now.Add(backoff(job.Attempts, queue.backoffBase, queue.backoffMax))
+
+	result, err := queue.client.Exec(fmt.Sprintf(retryJobQuery, queue.table), status, runAt, handlerErr.Error(), now,
+		job.ID, JobStatusRunning, job.LockedUntil.Time)
+	if err != nil {
+		return err
+	}
+
+	return checkJobLock(result)
+}
+
+// checkJobLock returns an error when a guarded update matched no row because the job is no longer locked by the
+// worker that ran it.
+func checkJobLock(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return voraserror.New(err, "error reading updated job rows")
+	}
+
+	if affected == 0 {
+		return voraserror.New(nil, "job lock was lost before the job was updated")
+	}
+
+	return nil
+}
+
+// runJobHandler turns a panicking handler into a failed attempt instead of killing the worker.
+func runJobHandler(ctx context.Context, handler JobHandler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job handler panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// backoff returns the exponential delay before the given attempt is retried, capped at max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		return base
+	}
+
+	delay := base
+
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
@@ -0,0 +1,456 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+	voraserrors "github.com/adminvoras/commons-lib/pkg/errors"
+)
+
+func Test_jobQueueBuilder_Build(t *testing.T) {
+	client, err := database.NewClientBuilder().
+		WithHost("anyhost").
+		WithDBName("dbname").
+		WithUsername("username").
+		WithPassword("password").
+		WithInitialPing(false).
+		Build()
+	assert.Nil(t, err, "Unexpected error building database client")
+
+	tests := []struct {
+		name      string
+		builder   database.JobQueueBuilder
+		wantedErr error
+	}{
+		{
+			name:      "Job queue is successfully created",
+			builder:   database.NewJobQueueBuilder(client).WithConcurrency(4),
+			wantedErr: nil,
+		},
+		{
+			name:      "Job queue is not created when the client is nil",
+			builder:   database.NewJobQueueBuilder(nil),
+			wantedErr: voraserrors.New(nil, "job queue database client cannot be nil"),
+		},
+		{
+			name:      "Job queue is not created when the table is empty",
+			builder:   database.NewJobQueueBuilder(client).WithTable(""),
+			wantedErr: voraserrors.New(nil, "job queue table cannot be empty"),
+		},
+		{
+			name:      "Job queue is not created when the table is not a valid identifier",
+			builder:   database.NewJobQueueBuilder(client).WithTable("jobs; DROP TABLE users"),
+			wantedErr: voraserrors.New(nil, `job queue table "jobs; DROP TABLE users" is not valid`),
+		},
+		{
+			name:      "Job queue is not created when the concurrency is zero",
+			builder:   database.NewJobQueueBuilder(client).WithConcurrency(0),
+			wantedErr: voraserrors.New(nil, "job queue concurrency must be greater than zero"),
+		},
+		{
+			name:      "Job queue is not created when the backoff max is lower than the base",
+			builder:   database.NewJobQueueBuilder(client).WithBackoff(time.Minute, time.Second),
+			wantedErr: voraserrors.New(nil, "job queue backoff is not valid"),
+		},
+		{
+			name:      "Job queue is not created when the visibility timeout is zero",
+			builder:   database.NewJobQueueBuilder(client).WithVisibilityTimeout(0),
+			wantedErr: voraserrors.New(nil, "job queue visibility timeout must be greater than zero"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+
+			if tt.wantedErr != nil {
+				assert.Equal(t, tt.wantedErr, err, "Error is not the expected building job queue")
+
+				return
+			}
+
+			assert.Nil(t, err, "Unexpected error building job queue")
+			assert.NotNil(t, got, "Job queue should be not nil")
+		})
+	}
+}
+
+// jobTable an in-memory jobs table answering the statements of the job queue through a database/sql driver.
+// Transactions hold the table lock until they finish, which is enough to emulate SELECT ... FOR UPDATE.
+type jobTable struct {
+	mu     sync.Mutex
+	jobs   []*database.Job
+	nextID int64
+}
+
+func newJobQueue(t *testing.T, table *jobTable, configure func(builder database.JobQueueBuilder)) database.JobQueue {
+	t.Helper()
+
+	builder := database.NewJobQueueBuilder(sqlx.NewDb(sql.OpenDB(table), "mysql")).
+		WithPollInterval(time.Millisecond).
+		WithBackoff(time.Millisecond, time.Millisecond)
+	if configure != nil {
+		configure(builder)
+	}
+
+	queue, err := builder.Build()
+	assert.Nil(t, err, "Unexpected error building job queue")
+
+	return queue
+}
+
+// job returns a copy of the stored job, safe to read while workers run.
+func (table *jobTable) job(id int64) database.Job {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	for _, job := range table.jobs {
+		if job.ID == id {
+			return *job
+		}
+	}
+
+	return database.Job{}
+}
+
+func (table *jobTable) update(id int64, update func(job *database.Job)) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	for _, job := range table.jobs {
+		if job.ID == id {
+			update(job)
+		}
+	}
+}
+
+func (table *jobTable) Connect(context.Context) (driver.Conn, error) {
+	return &jobTableConn{table: table}, nil
+}
+
+func (table *jobTable) Driver() driver.Driver {
+	return nil
+}
+
+type jobTableConn struct {
+	table *jobTable
+	inTx  bool
+}
+
+func (conn *jobTableConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (conn *jobTableConn) Close() error {
+	return nil
+}
+
+func (conn *jobTableConn) Begin() (driver.Tx, error) {
+	conn.table.mu.Lock()
+	conn.inTx = true
+
+	return conn, nil
+}
+
+func (conn *jobTableConn) Commit() error {
+	conn.inTx = false
+	conn.table.mu.Unlock()
+
+	return nil
+}
+
+func (conn *jobTableConn) Rollback() error {
+	return conn.Commit()
+}
+
+func (conn *jobTableConn) lock() func() {
+	if conn.inTx {
+		return func() {}
+	}
+
+	conn.table.mu.Lock()
+
+	return conn.table.mu.Unlock
+}
+
+func (conn *jobTableConn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result,
+	error) {
+	defer conn.lock()()
+
+	table := conn.table
+	args := values(named)
+	affected := int64(0)
+
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		table.nextID++
+		table.jobs = append(table.jobs, &database.Job{
+			ID: table.nextID, Queue: args[0].(string), Payload: args[1].([]byte), Priority: int(args[2].(int64)),
+			RunAt: args[3].(time.Time), MaxAttempts: int(args[4].(int64)), Status: database.JobStatus(args[5].(string)),
+		})
+
+		return jobResult{id: table.nextID, affected: 1}, nil
+	case strings.Contains(query, "attempts >= max_attempts"):
+		for _, job := range table.jobs {
+			expired := !job.LockedUntil.Time.After(args[5].(time.Time))
+			if job.Queue == args[3] && string(job.Status) == args[4] && expired && job.Attempts >= job.MaxAttempts {
+				job.Status, job.LockedUntil = database.JobStatus(args[0].(string)), sql.NullTime{}
+				job.LastError = sql.NullString{String: args[1].(string), Valid: true}
+				affected++
+			}
+		}
+	case strings.Contains(query, "attempts = attempts + 1"):
+		for _, job := range table.jobs {
+			if job.ID == args[3] {
+				job.Status, job.Attempts = database.JobStatus(args[0].(string)), job.Attempts+1
+				job.LockedUntil = sql.NullTime{Time: args[1].(time.Time), Valid: true}
+				affected++
+			}
+		}
+	case strings.Contains(query, "last_error = NULL"):
+		for _, job := range table.jobs {
+			if job.ID == args[2] && string(job.Status) == args[3] && job.LockedUntil.Time.Equal(args[4].(time.Time)) {
+				job.Status, job.LockedUntil = database.JobStatus(args[0].(string)), sql.NullTime{}
+				affected++
+			}
+		}
+	case strings.Contains(query, "run_at = ?"):
+		for _, job := range table.jobs {
+			if job.ID == args[4] && string(job.Status) == args[5] && job.LockedUntil.Time.Equal(args[6].(time.Time)) {
+				job.Status, job.RunAt = database.JobStatus(args[0].(string)), args[1].(time.Time)
+				job.LockedUntil, job.LastError = sql.NullTime{}, sql.NullString{String: args[2].(string), Valid: true}
+				affected++
+			}
+		}
+	default:
+		return nil, errors.New("unexpected statement " + query)
+	}
+
+	return jobResult{affected: affected}, nil
+}
+
+type jobResult struct {
+	id       int64
+	affected int64
+}
+
+func (result jobResult) LastInsertId() (int64, error) {
+	return result.id, nil
+}
+
+func (result jobResult) RowsAffected() (int64, error) {
+	return result.affected, nil
+}
+
+func (conn *jobTableConn) QueryContext(_ context.Context, _ string, named []driver.NamedValue) (driver.Rows, error) {
+	defer conn.lock()()
+
+	args := values(named)
+	rows := &jobRows{}
+
+	for _, job := range conn.table.jobs {
+		pending := string(job.Status) == args[1] && !job.RunAt.After(args[2].(time.Time))
+		expired := string(job.Status) == args[3] && !job.LockedUntil.Time.After(args[4].(time.Time)) &&
+			job.Attempts < job.MaxAttempts
+
+		if job.Queue == args[0] && (pending || expired) {
+			rows.jobs = append(rows.jobs, *job)
+
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+func values(named []driver.NamedValue) []interface{} {
+	args := make([]interface{}, len(named))
+	for i, value := range named {
+		args[i] = value.Value
+	}
+
+	return args
+}
+
+type jobRows struct {
+	jobs []database.Job
+}
+
+func (rows *jobRows) Columns() []string {
+	return []string{"id", "queue", "payload", "priority", "run_at", "attempts", "max_attempts", "status",
+		"locked_until", "last_error", "created_at", "updated_at"}
+}
+
+func (rows *jobRows) Close() error {
+	return nil
+}
+
+func (rows *jobRows) Next(dest []driver.Value) error {
+	if len(rows.jobs) == 0 {
+		return io.EOF
+	}
+
+	job := rows.jobs[0]
+	rows.jobs = rows.jobs[1:]
+
+	lockedUntil, _ := job.LockedUntil.Value()
+	lastError, _ := job.LastError.Value()
+
+	copy(dest, []driver.Value{job.ID, job.Queue, job.Payload, int64(job.Priority), job.RunAt, int64(job.Attempts),
+		int64(job.MaxAttempts), string(job.Status), lockedUntil, lastError, job.CreatedAt, job.UpdatedAt})
+
+	return nil
+}
+
+// runUntil runs the queue until the condition holds, failing the test if it never does.
+func runUntil(t *testing.T, queue database.JobQueue, handler database.JobHandler, condition func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- queue.Run(ctx, handler)
+	}()
+
+	assert.Eventually(t, condition, 2*time.Second, time.Millisecond, "Queue did not reach the expected state")
+	cancel()
+	assert.Nil(t, <-done, "Unexpected error running job queue")
+}
+
+func TestJobQueue_Run(t *testing.T) {
+	table := &jobTable{}
+	queue := newJobQueue(t, table, func(builder database.JobQueueBuilder) {
+		builder.WithConcurrency(2)
+	})
+
+	id, err := queue.Enqueue(&database.Job{Payload: []byte(`{"order":1}`)})
+	assert.Nil(t, err, "Unexpected error enqueueing job")
+
+	var mu sync.Mutex
+	runs := 0
+
+	runUntil(t, queue, func(ctx context.Context, job *database.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		runs++
+
+		assert.Equal(t, `{"order":1}`, string(job.Payload), "Job payload is not the expected")
+
+		return nil
+	}, func() bool {
+		return table.job(id).Status == database.JobStatusDone
+	})
+
+	assert.Equal(t, 1, runs, "Job should run once")
+	assert.Equal(t, 1, table.job(id).Attempts, "Job attempts are not the expected")
+}
+
+func TestJobQueue_Run_Retry(t *testing.T) {
+	table := &jobTable{}
+	queue := newJobQueue(t, table, nil)
+
+	id, err := queue.Enqueue(&database.Job{Payload: []byte("payload")})
+	assert.Nil(t, err, "Unexpected error enqueueing job")
+
+	runUntil(t, queue, func(ctx context.Context, job *database.Job) error {
+		if job.Attempts == 1 {
+			return errors.New("downstream unavailable")
+		}
+
+		return nil
+	}, func() bool {
+		return table.job(id).Status == database.JobStatusDone
+	})
+
+	job := table.job(id)
+	assert.Equal(t, 2, job.Attempts, "Job should be retried once")
+	assert.Equal(t, "downstream unavailable", job.LastError.String, "Last error should keep the failed attempt")
+}
+
+func TestJobQueue_Run_DeadLetter(t *testing.T) {
+	table := &jobTable{}
+	queue := newJobQueue(t, table, nil)
+
+	id, err := queue.Enqueue(&database.Job{Payload: []byte("payload"), MaxAttempts: 2})
+	assert.Nil(t, err, "Unexpected error enqueueing job")
+
+	runUntil(t, queue, func(ctx context.Context, job *database.Job) error {
+		panic("malformed payload")
+	}, func() bool {
+		return table.job(id).Status == database.JobStatusFailed
+	})
+
+	job := table.job(id)
+	assert.Equal(t, 2, job.Attempts, "Job should run every attempt")
+	assert.Equal(t, "job handler panic: malformed payload", job.LastError.String, "Last error is not the expected")
+}
+
+func TestJobQueue_Run_ExpiredJobWithoutAttemptsIsFailed(t *testing.T) {
+	table := &jobTable{}
+	queue := newJobQueue(t, table, nil)
+
+	id, err := queue.Enqueue(&database.Job{Payload: []byte("payload"), MaxAttempts: 1})
+	assert.Nil(t, err, "Unexpected error enqueueing job")
+
+	// The worker holding the last attempt crashed and its lock expired.
+	table.update(id, func(job *database.Job) {
+		job.Status, job.Attempts = database.JobStatusRunning, 1
+		job.LockedUntil = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	})
+
+	runUntil(t, queue, func(ctx context.Context, job *database.Job) error {
+		t.Error("Job without attempts left should not run")
+
+		return nil
+	}, func() bool {
+		return table.job(id).Status == database.JobStatusFailed
+	})
+
+	assert.Equal(t, 1, table.job(id).Attempts, "Job attempts are not the expected")
+}
+
+func TestJobQueue_Run_LostLockIsNotOverwritten(t *testing.T) {
+	table := &jobTable{}
+	queue := newJobQueue(t, table, nil)
+
+	id, err := queue.Enqueue(&database.Job{Payload: []byte("payload")})
+	assert.Nil(t, err, "Unexpected error enqueueing job")
+
+	reclaimedUntil := time.Now().Add(time.Hour).UTC()
+	handled := make(chan struct{})
+
+	runUntil(t, queue, func(ctx context.Context, job *database.Job) error {
+		// The lock expired while the handler ran and another worker claimed the job again.
+		table.update(id, func(job *database.Job) {
+			job.Attempts++
+			job.LockedUntil = sql.NullTime{Time: reclaimedUntil, Valid: true}
+		})
+		close(handled)
+
+		return nil
+	}, func() bool {
+		select {
+		case <-handled:
+			return true
+		default:
+			return false
+		}
+	})
+
+	job := table.job(id)
+	assert.Equal(t, database.JobStatusRunning, job.Status, "Job of the new worker should not be completed")
+	assert.Equal(t, reclaimedUntil, job.LockedUntil.Time, "Lock of the new worker should be kept")
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"errors"
+	"sync"
+)
+
+var errFlightPanicked = errors.New("deduplicated call panicked")
+
+// flightCall an in-flight or completed call of a flightGroup.
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flightGroup deduplicates concurrent calls sharing the same key so only one of them runs.
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn once for all the concurrent callers of the same key and returns its result to every one of them.
+func (group *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	group.mutex.Lock()
+
+	if group.calls == nil {
+		group.calls = make(map[string]*flightCall)
+	}
+
+	if call, ok := group.calls[key]; ok {
+		group.mutex.Unlock()
+		call.wg.Wait()
+
+		return call.val, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	group.calls[key] = call
+	group.mutex.Unlock()
+
+	completed := false
+
+	defer func() {
+		if !completed {
+			call.err = errFlightPanicked
+		}
+
+		group.mutex.Lock()
+		delete(group.calls, key)
+		group.mutex.Unlock()
+
+		call.wg.Done()
+	}()
+
+	call.val, call.err = fn()
+	completed = true
+
+	return call.val, call.err
+}
@@ -0,0 +1,387 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultTenantMaxClients       = 50
+	defaultTenantIdleTimeout      = 10 * time.Minute
+	defaultTenantCloseGracePeriod = time.Minute
+	minTenantEvictInterval        = time.Millisecond
+)
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of the context carrying the tenant ID used to route database calls.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID carried by the context, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantContextKey{}).(string)
+
+	return tenantID, ok && tenantID != ""
+}
+
+// TenantResolver returns the client builder configured for the tenant schema.
+type TenantResolver func(tenantID string) (ClientBuilder, error)
+
+// TenantRouter the tenant aware database client router interface.
+type TenantRouter interface {
+	// Client returns the client of the tenant carried by the context.
+	// The client must not be kept longer than the request using it, since it may be evicted in the meantime.
+	Client(ctx context.Context) (Client, error)
+	// ClientFor returns the client of the given tenant, building it on first use.
+	ClientFor(tenantID string) (Client, error)
+	// Close closes every open client and stops the idle eviction.
+	Close() error
+}
+
+// TenantRouterBuilder the tenant router builder interface.
+type TenantRouterBuilder interface {
+	WithResolver(resolver TenantResolver) TenantRouterBuilder
+	WithMaxClients(maxClients int) TenantRouterBuilder
+	WithIdleTimeout(idleTimeout time.Duration) TenantRouterBuilder
+	WithCloseGracePeriod(gracePeriod time.Duration) TenantRouterBuilder
+	WithLogger(logger log.ILogger) TenantRouterBuilder
+	Build() (TenantRouter, error)
+}
+
+// tenantRouterBuilder the tenant router builder.
+type tenantRouterBuilder struct {
+	resolver    TenantResolver
+	maxClients  int
+	idleTimeout time.Duration
+	gracePeriod time.Duration
+	logger      log.ILogger
+}
+
+// NewTenantRouterBuilder creates a new tenant router builder with default settings.
+func NewTenantRouterBuilder() TenantRouterBuilder {
+	builder := &tenantRouterBuilder{
+		maxClients:  defaultTenantMaxClients,
+		idleTimeout: defaultTenantIdleTimeout,
+		gracePeriod: defaultTenantCloseGracePeriod,
+		logger:      log.DefaultLogger(),
+	}
+
+	return builder
+}
+
+func (builder *tenantRouterBuilder) WithResolver(resolver TenantResolver) TenantRouterBuilder {
+	builder.resolver = resolver
+
+	return builder
+}
+
+func (builder *tenantRouterBuilder) WithMaxClients(maxClients int) TenantRouterBuilder {
+	builder.maxClients = maxClients
+
+	return builder
+}
+
+func (builder *tenantRouterBuilder) WithIdleTimeout(idleTimeout time.Duration) TenantRouterBuilder {
+	builder.idleTimeout = idleTimeout
+
+	return builder
+}
+
+// WithCloseGracePeriod sets how long the evicted clients stay open, so the callers still holding them can finish their
+// requests. Evicted clients still count toward the max clients, so they are closed before the grace period elapses
+// when a new tenant needs room.
+func (builder *tenantRouterBuilder) WithCloseGracePeriod(gracePeriod time.Duration) TenantRouterBuilder {
+	builder.gracePeriod = gracePeriod
+
+	return builder
+}
+
+func (builder *tenantRouterBuilder) WithLogger(logger log.ILogger) TenantRouterBuilder {
+	builder.logger = logger
+
+	return builder
+}
+
+func (builder *tenantRouterBuilder) Build() (TenantRouter, error) {
+	if builder.resolver == nil {
+		return nil, voraserror.New(nil, "tenant router resolver cannot be nil")
+	}
+
+	if builder.maxClients < 1 {
+		return nil, voraserror.New(nil, "tenant router max clients must be greater than zero")
+	}
+
+	if builder.idleTimeout < 0 {
+		return nil, voraserror.New(nil, "tenant router idle timeout cannot be negative")
+	}
+
+	if builder.gracePeriod < 0 {
+		return nil, voraserror.New(nil, "tenant router close grace period cannot be negative")
+	}
+
+	if builder.logger == nil {
+		return nil, voraserror.New(nil, "tenant router logger cannot be nil")
+	}
+
+	router := &tenantRouter{
+		resolver:    builder.resolver,
+		maxClients:  builder.maxClients,
+		idleTimeout: builder.idleTimeout,
+		gracePeriod: builder.gracePeriod,
+		logger:      builder.logger,
+		now:         time.Now,
+		clients:     make(map[string]*list.Element),
+		order:       list.New(),
+		retiring:    make(map[*tenantClient]*time.Timer),
+		done:        make(chan struct{}),
+	}
+
+	if router.idleTimeout > 0 {
+		go router.evictIdle()
+	}
+
+	return router, nil
+}
+
+type tenantClient struct {
+	tenantID  string
+	client    Client
+	lastUsed  time.Time
+	retiredAt time.Time
+}
+
+type tenantRouter struct {
+	resolver    TenantResolver
+	maxClients  int
+	idleTimeout time.Duration
+	gracePeriod time.Duration
+	logger      log.ILogger
+	now         func() time.Time
+	flight      flightGroup
+
+	mutex     sync.Mutex
+	clients   map[string]*list.Element
+	order     *list.List
+	retiring  map[*tenantClient]*time.Timer
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (router *tenantRouter) Client(ctx context.Context) (Client, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, voraserror.New(nil, "tenant not found in context")
+	}
+
+	return router.ClientFor(tenantID)
+}
+
+func (router *tenantRouter) ClientFor(tenantID string) (Client, error) {
+	if client, err := router.cached(tenantID); client != nil || err != nil {
+		return client, err
+	}
+
+	client, err := router.flight.do(tenantID, func() (interface{}, error) {
+		if client, err := router.cached(tenantID); client != nil || err != nil {
+			return client, err
+		}
+
+		builder, err := router.resolver(tenantID)
+		if err != nil {
+			return nil, voraserror.New(err, fmt.Sprintf("error resolving tenant %s", tenantID))
+		}
+
+		client, err := builder.Build()
+		if err != nil {
+			return nil, voraserror.New(err, fmt.Sprintf("error building client for tenant %s", tenantID))
+		}
+
+		return client, router.store(tenantID, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(Client), nil
+}
+
+func (router *tenantRouter) Close() error {
+	router.closeOnce.Do(func() {
+		close(router.done)
+	})
+
+	router.mutex.Lock()
+
+	router.closed = true
+
+	entries := make([]*tenantClient, 0, router.order.Len()+len(router.retiring))
+	for element := router.order.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*tenantClient))
+	}
+
+	for entry, timer := range router.retiring {
+		timer.Stop()
+		entries = append(entries, entry)
+	}
+
+	router.clients = make(map[string]*list.Element)
+	router.order.Init()
+	router.retiring = make(map[*tenantClient]*time.Timer)
+
+	router.mutex.Unlock()
+
+	for _, entry := range entries {
+		router.close(entry)
+	}
+
+	return nil
+}
+
+// cached returns the open client of the tenant, or nil if it has not been built yet.
+func (router *tenantRouter) cached(tenantID string) (Client, error) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	if router.closed {
+		return nil, voraserror.New(nil, "tenant router is closed")
+	}
+
+	element, ok := router.clients[tenantID]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := element.Value.(*tenantClient)
+	entry.lastUsed = router.now()
+	router.order.MoveToFront(element)
+
+	return entry.client, nil
+}
+
+// store keeps the tenant client, retiring the least recently used ones beyond the max clients. Retired clients count
+// toward the max clients too, so the oldest ones are closed without waiting for the grace period to bound the open
+// clients.
+func (router *tenantRouter) store(tenantID string, client Client) error {
+	router.mutex.Lock()
+
+	if router.closed {
+		router.mutex.Unlock()
+		closeClient(client)
+
+		return voraserror.New(nil, "tenant router is closed")
+	}
+
+	entry := &tenantClient{tenantID: tenantID, client: client, lastUsed: router.now()}
+	router.clients[tenantID] = router.order.PushFront(entry)
+
+	for router.order.Len() > router.maxClients {
+		router.retire(router.order.Back())
+	}
+
+	overflow := []*tenantClient{}
+	for router.order.Len()+len(router.retiring) > router.maxClients {
+		overflow = append(overflow, router.takeOldestRetiring())
+	}
+
+	router.mutex.Unlock()
+
+	for _, entry := range overflow {
+		router.close(entry)
+	}
+
+	return nil
+}
+
+// evictIdle periodically retires the clients not used during the idle timeout until the router is closed.
+func (router *tenantRouter) evictIdle() {
+	interval := router.idleTimeout / 2
+	if interval < minTenantEvictInterval {
+		interval = minTenantEvictInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-router.done:
+			return
+		case <-ticker.C:
+			router.mutex.Lock()
+
+			now := router.now()
+			for element := router.order.Back(); element != nil; element = router.order.Back() {
+				if now.Sub(element.Value.(*tenantClient).lastUsed) < router.idleTimeout {
+					break
+				}
+
+				router.retire(element)
+			}
+
+			router.mutex.Unlock()
+		}
+	}
+}
+
+// retire stops routing to the client of the element and closes it once the grace period elapses, so the callers
+// that already got it are not cut off in the middle of a request. The mutex must be held.
+func (router *tenantRouter) retire(element *list.Element) {
+	entry := element.Value.(*tenantClient)
+
+	router.order.Remove(element)
+	delete(router.clients, entry.tenantID)
+
+	entry.retiredAt = router.now()
+	router.retiring[entry] = time.AfterFunc(router.gracePeriod, func() {
+		router.mutex.Lock()
+		_, ok := router.retiring[entry]
+		delete(router.retiring, entry)
+		router.mutex.Unlock()
+
+		// Close may have taken the client already.
+		if ok {
+			router.close(entry)
+		}
+	})
+}
+
+// takeOldestRetiring stops the grace period of the client retired first and returns it to be closed. The mutex must be
+// held and at least one client must be retiring.
+func (router *tenantRouter) takeOldestRetiring() *tenantClient {
+	var oldest *tenantClient
+
+	for entry := range router.retiring {
+		if oldest == nil || entry.retiredAt.Before(oldest.retiredAt) {
+			oldest = entry
+		}
+	}
+
+	router.retiring[oldest].Stop()
+	delete(router.retiring, oldest)
+
+	return oldest
+}
+
+func (router *tenantRouter) close(entry *tenantClient) {
+	if err := closeClient(entry.client); err != nil {
+		router.logger.Error(router, map[string]string{"tenant": entry.tenantID}, err, "Error closing tenant client")
+	}
+}
+
+func closeClient(client Client) error {
+	if closer, ok := client.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+)
+
+// fakeClientBuilder builds fake clients counting how many were built.
+type fakeClientBuilder struct {
+	database.ClientBuilder
+	built  *int
+	client database.Client
+}
+
+func (builder fakeClientBuilder) Build() (database.Client, error) {
+	if builder.client != nil {
+		return builder.client, nil
+	}
+
+	*builder.built++
+
+	return &fakeClient{}, nil
+}
+
+func TestTenantRouter_Client(t *testing.T) {
+	built := 0
+	resolved := []string{}
+
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			resolved = append(resolved, tenantID)
+
+			return fakeClientBuilder{built: &built}, nil
+		}).
+		WithMaxClients(1).
+		WithIdleTimeout(0).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	defer router.Close()
+
+	first, err := router.Client(database.WithTenant(context.Background(), "acme"))
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	again, err := router.Client(database.WithTenant(context.Background(), "acme"))
+	assert.Nil(t, err, "Unexpected error routing tenant")
+	assert.Same(t, first, again, "Tenant client should be cached")
+
+	_, err = router.ClientFor("globex")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	_, err = router.ClientFor("acme")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	assert.Equal(t, []string{"acme", "globex", "acme"}, resolved, "Evicted tenant should be built again")
+	assert.Equal(t, 3, built, "Clients built are not the expected")
+}
+
+func TestTenantRouter_Client_WithoutTenant(t *testing.T) {
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			return nil, errors.New("unexpected call")
+		}).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	defer router.Close()
+
+	_, err = router.Client(context.Background())
+
+	assert.NotNil(t, err, "Missing tenant should be rejected")
+}
+
+func TestTenantRouter_EvictIdle(t *testing.T) {
+	built := 0
+
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			return fakeClientBuilder{built: &built}, nil
+		}).
+		WithIdleTimeout(10 * time.Millisecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	defer router.Close()
+
+	_, err = router.ClientFor("acme")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	time.Sleep(40 * time.Millisecond)
+
+	_, err = router.ClientFor("acme")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+	assert.Equal(t, 2, built, "Idle client should be evicted and built again")
+}
+
+// closableClient a fake client recording whether it was closed.
+type closableClient struct {
+	fakeClient
+	closed atomic.Bool
+}
+
+func (client *closableClient) Close() error {
+	client.closed.Store(true)
+
+	return nil
+}
+
+func TestTenantRouter_EvictIdle_ShortIdleTimeout(t *testing.T) {
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			return fakeClientBuilder{client: &closableClient{}}, nil
+		}).
+		WithIdleTimeout(time.Nanosecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	_, err = router.ClientFor("acme")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Nil(t, router.Close(), "Unexpected error closing tenant router")
+}
+
+func TestTenantRouter_EvictedClientIsClosedAfterGracePeriod(t *testing.T) {
+	var built atomic.Pointer[closableClient]
+
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			client := &closableClient{}
+			built.Store(client)
+
+			return fakeClientBuilder{client: client}, nil
+		}).
+		WithIdleTimeout(10 * time.Millisecond).
+		WithCloseGracePeriod(200 * time.Millisecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	defer router.Close()
+
+	held, err := router.ClientFor("acme")
+	assert.Nil(t, err, "Unexpected error routing tenant")
+
+	evicted := built.Load()
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.False(t, evicted.closed.Load(), "Evicted client held by a caller should stay open")
+
+	_, err = held.Exec("UPDATE orders SET status = ?", "paid")
+	assert.Nil(t, err, "Held client should keep working after the eviction")
+
+	assert.Eventually(t, evicted.closed.Load, time.Second, 5*time.Millisecond,
+		"Evicted client should be closed after the grace period")
+}
+
+func TestTenantRouter_EvictedClientsCountTowardMaxClients(t *testing.T) {
+	clients := map[string]*closableClient{"acme": {}, "globex": {}, "initech": {}}
+
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			return fakeClientBuilder{client: clients[tenantID]}, nil
+		}).
+		WithMaxClients(2).
+		WithIdleTimeout(0).
+		WithCloseGracePeriod(time.Hour).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	defer router.Close()
+
+	for _, tenantID := range []string{"acme", "globex", "initech"} {
+		_, err = router.ClientFor(tenantID)
+		assert.Nil(t, err, "Unexpected error routing tenant")
+	}
+
+	assert.True(t, clients["acme"].closed.Load(), "Evicted client should be closed when a new tenant needs room")
+	assert.False(t, clients["globex"].closed.Load(), "Routed client should stay open")
+	assert.False(t, clients["initech"].closed.Load(), "Routed client should stay open")
+}
+
+func TestTenantRouter_Close(t *testing.T) {
+	clients := map[string]*closableClient{"acme": {}, "globex": {}}
+
+	router, err := database.NewTenantRouterBuilder().
+		WithResolver(func(tenantID string) (database.ClientBuilder, error) {
+			return fakeClientBuilder{client: clients[tenantID]}, nil
+		}).
+		WithMaxClients(1).
+		WithCloseGracePeriod(time.Hour).
+		Build()
+	assert.Nil(t, err, "Unexpected error building tenant router")
+
+	_, _ = router.ClientFor("acme")
+	_, _ = router.ClientFor("globex")
+
+	assert.Nil(t, router.Close(), "Unexpected error closing tenant router")
+
+	assert.True(t, clients["acme"].closed.Load(), "Evicted client should be closed with the router")
+	assert.True(t, clients["globex"].closed.Load(), "Routed client should be closed with the router")
+}
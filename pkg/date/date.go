@@ -20,6 +20,9 @@ const (
 	stdNumColonSecondsTZ     = "2006-01-02T15:04:05.999-07:00:00"  // "-07:00:00"
 )
 
+// NumTZLayout is the layout used by NumTZDate.
+const NumTZLayout = stdNumTZ
+
 type JsonDate interface {
 	UnmarshalJSON(data []byte) error
 	MarshalJSON() ([]byte, error)
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -24,6 +25,10 @@ type ILogger interface {
 	GetTags(source interface{}, tags map[string]string) []string
 }
 
+type loggerContextKey struct{}
+
+type actorContextKey struct{}
+
 type log struct {
 	mutex      sync.Mutex
 	requestID  string
@@ -42,6 +47,35 @@ func NewLogger(requestID string) ILogger {
 	return iLogger
 }
 
+// WithLogger returns a copy of the context carrying the logger.
+func WithLogger(ctx context.Context, logger ILogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or a new default logger if there is none.
+func FromContext(ctx context.Context) ILogger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerContextKey{}).(ILogger); ok && logger != nil {
+			return logger
+		}
+	}
+
+	return DefaultLogger()
+}
+
+// WithActor returns a copy of the context carrying the user acting on the request, shared by the packages recording
+// who made a change.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the user acting on the request or an empty string if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+
+	return actor
+}
+
 func (theLogger *log) Info(source interface{}, tags map[string]string, message string, args ...interface{}) {
 	logger.Info(theLogger.GetMessage(message, args...), theLogger.GetTags(source, tags)...)
 }
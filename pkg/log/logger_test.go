@@ -1,6 +1,7 @@
 package log_test
 
 import (
+	"context"
 	"sort"
 	"testing"
 
@@ -195,3 +196,19 @@ func Test_log_GetTags(t *testing.T) {
 		})
 	}
 }
+
+func TestFromContext(t *testing.T) {
+	logger := log.NewLogger("the-request-id")
+
+	got := log.FromContext(log.WithLogger(context.Background(), logger))
+	assert.Equal(t, "the-request-id", got.GetRequestID(), "Logger is not the one in the context")
+
+	got = log.FromContext(context.Background())
+	assert.True(t, len(got.GetRequestID()) > 0, "Default logger should be returned when the context has none")
+}
+
+func TestActorFromContext(t *testing.T) {
+	assert.Equal(t, "user-1", log.ActorFromContext(log.WithActor(context.Background(), "user-1")),
+		"Actor is not the one in the context")
+	assert.Empty(t, log.ActorFromContext(context.Background()), "Context without actor should have none")
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+// AccessLogOptions the options of the access log middleware.
+type AccessLogOptions struct {
+	// SkipPaths the request paths never logged, such as health checks.
+	SkipPaths []string
+	// SuccessSampleRate the fraction of requests answered with a 1xx, 2xx or 3xx status that are logged.
+	// Values outside (0, 1) log every request.
+	SuccessSampleRate float64
+}
+
+// accessLog the access log entry source, used as the Class tag of the log lines.
+type accessLog struct {
+	skipPaths  map[string]struct{}
+	sampleRate float64
+}
+
+// AccessLog returns a middleware logging every request through the request logger of pkg/log, tagged with the
+// method, route pattern, status, response size, latency, remote IP and user agent. Server errors are logged at error
+// level, client errors at warn level and the rest at info level. It must run after RequestID to log the request ID.
+func AccessLog(opts AccessLogOptions) func(http.Handler) http.Handler {
+	logger := &accessLog{
+		skipPaths:  make(map[string]struct{}, len(opts.SkipPaths)),
+		sampleRate: opts.SuccessSampleRate,
+	}
+
+	for _, path := range opts.SkipPaths {
+		logger.skipPaths[path] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := logger.skipPaths[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			start := time.Now()
+			wrapped := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				logger.log(r, wrapped, time.Since(start))
+			}()
+
+			next.ServeHTTP(wrapped, r)
+		})
+	}
+}
+
+func (logger *accessLog) log(r *http.Request, w middleware.WrapResponseWriter, latency time.Duration) {
+	status := w.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if status < http.StatusBadRequest && logger.sampleRate > 0 && logger.sampleRate < 1 &&
+		rand.Float64() >= logger.sampleRate {
+		return
+	}
+
+	route := r.URL.Path
+	if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+		route = routeContext.RoutePattern()
+	}
+
+	tags := map[string]string{
+		"method":     r.Method,
+		"route":      route,
+		"status":     strconv.Itoa(status),
+		"size":       strconv.Itoa(w.BytesWritten()),
+		"latency_ms": strconv.FormatFloat(float64(latency.Microseconds())/1000, 'f', 3, 64),
+		"remote_ip":  remoteIP(r),
+		"user_agent": r.UserAgent(),
+	}
+
+	requestLogger := log.FromContext(r.Context())
+	message := fmt.Sprintf("%s %s %d", r.Method, route, status)
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		requestLogger.Error(logger, tags, fmt.Errorf("status %d", status), message)
+	case status >= http.StatusBadRequest:
+		requestLogger.Warn(logger, tags, message)
+	default:
+		requestLogger.Info(logger, tags, message)
+	}
+}
+
+// remoteIP returns the IP of the remote address without its port, or the remote address as is if it has none.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,102 @@
+package web_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/utils/logger"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		status     int
+		wantLogs   []string
+	}{
+		{
+			name:     "Successful request is logged at info level with the route pattern",
+			path:     "/users/42",
+			status:   http.StatusOK,
+			wantLogs: []string{"[level:info]", `[route:"/users/{id}"]`, "[status:200]", "[method:GET]", "[size:2]"},
+		},
+		{
+			name:     "Remote IP is logged without the port",
+			path:     "/users/42",
+			status:   http.StatusOK,
+			wantLogs: []string{"[remote_ip:192.0.2.1]"},
+		},
+		{
+			name:       "Remote address without port is logged as is",
+			path:       "/users/42",
+			remoteAddr: "192.0.2.1",
+			status:     http.StatusOK,
+			wantLogs:   []string{"[remote_ip:192.0.2.1]"},
+		},
+		{
+			name:     "Client error is logged at warn level",
+			path:     "/users/42",
+			status:   http.StatusNotFound,
+			wantLogs: []string{"[level:warn]", "[status:404]"},
+		},
+		{
+			name:     "Server error is logged at error level",
+			path:     "/users/42",
+			status:   http.StatusInternalServerError,
+			wantLogs: []string{"[level:error]", "[status:500]"},
+		},
+		{
+			name:     "Skipped path is not logged",
+			path:     "/health",
+			status:   http.StatusOK,
+			wantLogs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			logger.SetLogLevel("debug")
+			logger.Log.Out = buffer
+
+			defer func() {
+				logger.Log.Out = os.Stdout
+			}()
+
+			router := chi.NewRouter()
+			router.Use(web.RequestID, web.AccessLog(web.AccessLogOptions{SkipPaths: []string{"/health"}}))
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("{}"))
+			}
+			router.Get("/users/{id}", handler)
+			router.Get("/health", handler)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantLogs == nil {
+				assert.Empty(t, buffer.String(), "Request should not be logged")
+
+				return
+			}
+
+			for _, want := range tt.wantLogs {
+				assert.Contains(t, buffer.String(), want, "Access log is not the expected")
+			}
+		})
+	}
+}
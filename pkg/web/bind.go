@@ -0,0 +1,243 @@
+package web
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/adminvoras/commons-lib/pkg/date"
+)
+
+const (
+	urlParamTag   = "param"
+	queryParamTag = "query"
+	defaultTag    = "default"
+	layoutTag     = "layout"
+	requiredFlag  = "required"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	numTZDateType       = reflect.TypeOf(date.NumTZDate{})
+)
+
+// BindParams fills the fields of dst, a pointer to a struct, tagged with param (URL parameters) or query (query
+// string parameters), then validates dst with Validate.
+//
+//	type listOrders struct {
+//		UserID uuid.UUID  `param:"user_id"`
+//		Status string     `query:"status,required" validate:"enum=open|closed"`
+//		Page   int        `query:"page" default:"1" validate:"min=1"`
+//		Since  *time.Time `query:"since" layout:"2006-01-02"`
+//		IDs    []int64    `query:"id"`
+//	}
+//
+// Supported field types are strings, integers, floats, bools, time.Time, date.NumTZDate, types implementing
+// encoding.TextUnmarshaler such as uuid.UUID, pointers to them for optional values, and slices of them for repeated
+// query parameters. Missing parameters keep the field value unless a default tag is present.
+// It returns a *ParamError for missing required or malformed parameters and a *ValidationError for broken rules.
+func BindParams(r *http.Request, dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a non nil pointer to a struct, got %T", dst)
+	}
+
+	if err := bindStruct(r, value.Elem()); err != nil {
+		return err
+	}
+
+	return Validate(dst)
+}
+
+func bindStruct(r *http.Request, value reflect.Value) error {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindStruct(r, value.Field(i)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		source, tag := fieldParamSource(field)
+		if source == "" {
+			continue
+		}
+
+		name, flags, _ := strings.Cut(tag, ",")
+		values := paramValues(r, source, name)
+
+		if len(values) == 0 {
+			if def, ok := field.Tag.Lookup(defaultTag); ok {
+				values = []string{def}
+			} else if strings.Contains(flags, requiredFlag) {
+				return &ParamError{Source: source, Name: name, Reason: "is required"}
+			} else {
+				continue
+			}
+		}
+
+		if err := setField(value.Field(i), values, field.Tag.Get(layoutTag)); err != nil {
+			return &ParamError{Source: source, Name: name, Value: strings.Join(values, ","), Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+func fieldParamSource(field reflect.StructField) (ParamSource, string) {
+	if tag, ok := field.Tag.Lookup(urlParamTag); ok {
+		return URLParamSource, tag
+	}
+
+	if tag, ok := field.Tag.Lookup(queryParamTag); ok {
+		return QueryParamSource, tag
+	}
+
+	return "", ""
+}
+
+func paramValues(r *http.Request, source ParamSource, name string) []string {
+	if source == QueryParamSource {
+		return r.URL.Query()[name]
+	}
+
+	routeContext := chi.RouteContext(r.Context())
+	if routeContext == nil {
+		return nil
+	}
+
+	if value := routeContext.URLParam(name); value != "" {
+		return []string{value}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, values []string, layout string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshalerType) &&
+		field.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value, layout); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+
+		return nil
+	}
+
+	return setValue(field, values[0], layout)
+}
+
+func setValue(field reflect.Value, value, layout string) error {
+	if field.Kind() == reflect.Ptr {
+		target := reflect.New(field.Type().Elem())
+		if err := setValue(target.Elem(), value, layout); err != nil {
+			return err
+		}
+
+		field.Set(target)
+
+		return nil
+	}
+
+	var layouts []string
+	if layout != "" {
+		layouts = []string{layout}
+	}
+
+	switch field.Type() {
+	case timeType:
+		parsed, err := ParseTime(layouts...)(value)
+		if err != nil {
+			return err
+		}
+
+		field.Set(reflect.ValueOf(parsed))
+
+		return nil
+	case numTZDateType:
+		parsed, err := ParseTime(layouts...)(value)
+		if err != nil {
+			return err
+		}
+
+		field.Set(reflect.ValueOf(date.NumTZDate{Time: parsed}))
+
+		return nil
+	}
+
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		if err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("is not valid")
+		}
+
+		return nil
+	}
+
+	return setKind(field, value)
+}
+
+func setKind(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := ParseInt64(value)
+		if err != nil {
+			return err
+		}
+
+		if field.OverflowInt(parsed) {
+			return fmt.Errorf("is out of range")
+		}
+
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := ParseUint(value)
+		if err != nil {
+			return err
+		}
+
+		if field.OverflowUint(uint64(parsed)) {
+			return fmt.Errorf("is out of range")
+		}
+
+		field.SetUint(uint64(parsed))
+	case reflect.Float32, reflect.Float64:
+		parsed, err := ParseFloat(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("has an unsupported type %s", field.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,464 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultClientTimeout    = 10 * time.Second
+	defaultClientMaxRetries = 2
+	defaultClientBackoff    = 100 * time.Millisecond
+	defaultClientMaxBackoff = 2 * time.Second
+	maxErrorBodyBytes       = 64 << 10
+)
+
+// ResponseError the error returned by the JSON helpers of the Client when the response status is not 2xx.
+type ResponseError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte
+}
+
+func (err *ResponseError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", err.Method, err.URL, err.StatusCode,
+		strings.TrimSpace(string(err.Body)))
+}
+
+// Client the outbound HTTP client interface.
+type Client interface {
+	// Do sends the request applying the default headers, the request ID, the remaining time budget of the context
+	// deadline as X-Request-Timeout and the retry policy. When a base URL is set, the default headers are only sent
+	// to its host, since they may carry credentials.
+	// Like http.Client, it does not return an error for non 2xx responses.
+	Do(req *http.Request) (*http.Response, error)
+	// DoJSON sends in encoded the same way EncodeJSON does and decodes the JSON response into out.
+	// A nil out discards the response body and a *[]byte receives it raw.
+	// It returns a *ResponseError for non 2xx responses.
+	DoJSON(ctx context.Context, method, path string, in, out interface{}) error
+	Get(ctx context.Context, path string, out interface{}) error
+	Post(ctx context.Context, path string, in, out interface{}) error
+	Put(ctx context.Context, path string, in, out interface{}) error
+	Patch(ctx context.Context, path string, in, out interface{}) error
+	Delete(ctx context.Context, path string, out interface{}) error
+}
+
+// ClientBuilder the outbound HTTP client builder interface.
+type ClientBuilder interface {
+	WithBaseURL(baseURL string) ClientBuilder
+	WithHeader(key, value string) ClientBuilder
+	WithTimeout(timeout time.Duration) ClientBuilder
+	WithMaxRetries(maxRetries int) ClientBuilder
+	WithBackoff(base, max time.Duration) ClientBuilder
+	WithTransport(transport http.RoundTripper) ClientBuilder
+	Build() (Client, error)
+}
+
+// clientBuilder the outbound HTTP client builder.
+type clientBuilder struct {
+	baseURL    string
+	headers    http.Header
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	transport  http.RoundTripper
+}
+
+// NewClientBuilder creates a new outbound HTTP client builder with default settings.
+// Idempotent requests failing with a network error, a 5xx or a 429 status are retried with exponential backoff and
+// jitter, honoring the Retry-After header. A Retry-After longer than the max backoff is not waited for, the response is
+// returned as it is instead.
+func NewClientBuilder() ClientBuilder {
+	builder := &clientBuilder{
+		headers:    make(http.Header),
+		timeout:    defaultClientTimeout,
+		maxRetries: defaultClientMaxRetries,
+		backoff:    defaultClientBackoff,
+		maxBackoff: defaultClientMaxBackoff,
+		transport:  http.DefaultTransport,
+	}
+
+	return builder
+}
+
+func (builder *clientBuilder) WithBaseURL(baseURL string) ClientBuilder {
+	builder.baseURL = baseURL
+
+	return builder
+}
+
+func (builder *clientBuilder) WithHeader(key, value string) ClientBuilder {
+	builder.headers.Add(key, value)
+
+	return builder
+}
+
+func (builder *clientBuilder) WithTimeout(timeout time.Duration) ClientBuilder {
+	builder.timeout = timeout
+
+	return builder
+}
+
+func (builder *clientBuilder) WithMaxRetries(maxRetries int) ClientBuilder {
+	builder.maxRetries = maxRetries
+
+	return builder
+}
+
+func (builder *clientBuilder) WithBackoff(base, max time.Duration) ClientBuilder {
+	builder.backoff = base
+	builder.maxBackoff = max
+
+	return builder
+}
+
+func (builder *clientBuilder) WithTransport(transport http.RoundTripper) ClientBuilder {
+	builder.transport = transport
+
+	return builder
+}
+
+func (builder *clientBuilder) Build() (Client, error) {
+	var baseURL *url.URL
+
+	if builder.baseURL != "" {
+		parsed, err := url.Parse(builder.baseURL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, voraserror.New(err, "client base URL is not valid")
+		}
+
+		baseURL = parsed
+	}
+
+	if builder.timeout <= 0 {
+		return nil, voraserror.New(nil, "client timeout must be greater than zero")
+	}
+
+	if builder.maxRetries < 0 {
+		return nil, voraserror.New(nil, "client max retries cannot be negative")
+	}
+
+	if builder.backoff <= 0 || builder.maxBackoff < builder.backoff {
+		return nil, voraserror.New(nil, "client backoff is not valid")
+	}
+
+	if builder.transport == nil {
+		return nil, voraserror.New(nil, "client transport cannot be nil")
+	}
+
+	return &client{
+		httpClient: &http.Client{Transport: builder.transport, Timeout: builder.timeout},
+		baseURL:    baseURL,
+		headers:    builder.headers.Clone(),
+		maxRetries: builder.maxRetries,
+		backoff:    builder.backoff,
+		maxBackoff: builder.maxBackoff,
+	}, nil
+}
+
+type client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	headers    http.Header
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (theClient *client) Get(ctx context.Context, path string, out interface{}) error {
+	return theClient.DoJSON(ctx, http.MethodGet, path, nil, out)
+}
+
+func (theClient *client) Post(ctx context.Context, path string, in, out interface{}) error {
+	return theClient.DoJSON(ctx, http.MethodPost, path, in, out)
+}
+
+func (theClient *client) Put(ctx context.Context, path string, in, out interface{}) error {
+	return theClient.DoJSON(ctx, http.MethodPut, path, in, out)
+}
+
+func (theClient *client) Patch(ctx context.Context, path string, in, out interface{}) error {
+	return theClient.DoJSON(ctx, http.MethodPatch, path, in, out)
+}
+
+func (theClient *client) Delete(ctx context.Context, path string, out interface{}) error {
+	return theClient.DoJSON(ctx, http.MethodDelete, path, nil, out)
+}
+
+func (theClient *client) DoJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	target, err := theClient.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = http.NoBody
+	if in != nil {
+		body, err := marshalJSON(in)
+		if err != nil {
+			return voraserror.New(err, "error encoding request body")
+		}
+
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return voraserror.New(err, "error creating request")
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := theClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		errorBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+		return &ResponseError{Method: method, URL: target, StatusCode: resp.StatusCode, Body: errorBody}
+	}
+
+	return decodeBody(resp, out)
+}
+
+func (theClient *client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	if theClient.baseURL == nil || sameOrigin(req.URL, theClient.baseURL) {
+		for key, values := range theClient.headers {
+			if req.Header.Get(key) == "" {
+				req.Header[key] = append([]string(nil), values...)
+			}
+		}
+	}
+
+	if requestID := RequestIDFromContext(ctx); requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	if err := replayableBody(req); err != nil {
+		return nil, err
+	}
+
+	// The budget shrinks with every attempt, so it is set on each one unless the caller set the header.
+	propagateTimeout := req.Header.Get(RequestTimeoutHeader) == ""
+
+	retries := theClient.maxRetries
+	if !isIdempotent(req.Method) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if timeout, ok := requestTimeoutHeaderValue(ctx); ok && propagateTimeout {
+			req.Header.Set(RequestTimeoutHeader, timeout)
+		}
+
+		resp, err := theClient.httpClient.Do(req)
+
+		if attempt >= retries || !shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := theClient.delay(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+
+		// Waiting longer than the caller is willing to would only turn the response into a deadline error.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+			resp.Body.Close()
+		}
+
+		log.FromContext(ctx).Warn(theClient, map[string]string{"method": req.Method, "url": req.URL.String()},
+			"Retrying request in %s after attempt %d failed", delay, attempt+1)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, voraserror.New(err, "error rewinding request body")
+			}
+
+			req.Body = body
+		}
+	}
+}
+
+// delay returns how long to wait before the next attempt, honoring Retry-After if the server sent it. It returns false
+// when the server asks to wait longer than the max backoff, so the request is not retried.
+func (theClient *client) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= theClient.maxBackoff
+		}
+	}
+
+	delay := theClient.backoff << attempt
+	if delay <= 0 || delay > theClient.maxBackoff {
+		delay = theClient.maxBackoff
+	}
+
+	// Equal jitter: half of the delay is fixed and the other half random.
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+func (theClient *client) resolve(path string) (string, error) {
+	target, err := url.Parse(path)
+	if err != nil {
+		return "", voraserror.New(err, "request path is not valid")
+	}
+
+	if theClient.baseURL == nil {
+		return target.String(), nil
+	}
+
+	if target.IsAbs() || target.Host != "" {
+		if !sameOrigin(target, theClient.baseURL) {
+			return "", voraserror.New(nil, fmt.Sprintf("request URL %s is not on the base URL host", target.Redacted()))
+		}
+
+		return target.String(), nil
+	}
+
+	// Joined escaped, so encoded characters such as %2F in a path segment are kept.
+	escapedPath := strings.TrimRight(theClient.baseURL.EscapedPath(), "/") + "/" +
+		strings.TrimLeft(target.EscapedPath(), "/")
+
+	unescapedPath, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return "", voraserror.New(err, "request path is not valid")
+	}
+
+	base := *theClient.baseURL
+	base.Path, base.RawPath = unescapedPath, escapedPath
+	base.RawQuery = target.RawQuery
+
+	return base.String(), nil
+}
+
+// sameOrigin returns true if both URLs have the same scheme and host.
+func sameOrigin(target, base *url.URL) bool {
+	return strings.EqualFold(target.Scheme, base.Scheme) && strings.EqualFold(target.Host, base.Host)
+}
+
+// replayableBody makes sure the request body can be sent again on retries.
+func replayableBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		return voraserror.New(err, "error reading request body")
+	}
+
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+
+	return nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses the Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+
+		return delay, true
+	}
+
+	return 0, false
+}
+
+func decodeBody(resp *http.Response, out interface{}) error {
+	switch out := out.(type) {
+	case nil:
+		_, err := io.Copy(io.Discard, resp.Body)
+
+		return err
+	case *[]byte:
+		body, err := io.ReadAll(resp.Body)
+		*out = body
+
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return voraserror.New(err, "error decoding response body")
+	}
+
+	return nil
+}
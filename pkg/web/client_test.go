@@ -0,0 +1,164 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestClient_Get(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/users/1", r.URL.Path, "Path is not the expected")
+		assert.Equal(t, "the-request-id", r.Header.Get(web.RequestIDHeader), "Request ID should be propagated")
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"), "Default header should be sent")
+
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_ = web.EncodeJSON(w, user{ID: 1, Name: "John"}, http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := web.NewClientBuilder().
+		WithBaseURL(server.URL+"/api").
+		WithHeader("X-Api-Key", "secret").
+		WithBackoff(time.Millisecond, 5*time.Millisecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building client")
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "the-request-id")
+	got := user{}
+
+	err = client.Get(ctx, "/users/1", &got)
+
+	assert.Nil(t, err, "Unexpected error getting user")
+	assert.Equal(t, user{ID: 1, Name: "John"}, got, "User is not the expected")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts), "Request should be retried until it succeeds")
+}
+
+func TestClient_Get_LongRetryAfterIsNotWaited(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, err := web.NewClientBuilder().
+		WithBaseURL(server.URL).
+		WithBackoff(time.Millisecond, time.Second).
+		Build()
+	assert.Nil(t, err, "Unexpected error building client")
+
+	start := time.Now()
+
+	err = client.Get(context.Background(), "/users/1", nil)
+
+	responseErr := &web.ResponseError{}
+	assert.True(t, errors.As(err, &responseErr), "Error should be a response error")
+	assert.Equal(t, http.StatusServiceUnavailable, responseErr.StatusCode, "Status is not the expected")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts), "Request should not be retried")
+	assert.Less(t, time.Since(start), time.Second, "Client should not wait for the Retry-After")
+}
+
+func TestClient_Post(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"id":0,"name":"John"}`, string(body), "Body is not the expected")
+		assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"),
+			"Content type is not the expected")
+
+		_ = web.EncodeJSON(w, map[string]string{"error": "unavailable"}, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, err := web.NewClientBuilder().WithBaseURL(server.URL).Build()
+	assert.Nil(t, err, "Unexpected error building client")
+
+	err = client.Post(context.Background(), "users", user{Name: "John"}, nil)
+
+	var responseErr *web.ResponseError
+	assert.True(t, errors.As(err, &responseErr), "Error should be a response error")
+	assert.Equal(t, http.StatusServiceUnavailable, responseErr.StatusCode, "Status is not the expected")
+	assert.JSONEq(t, `{"error":"unavailable"}`, string(responseErr.Body), "Error body is not the expected")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts), "Non idempotent requests should not be retried")
+}
+
+func TestClient_Get_EncodedPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/files/reports%2F2024", r.URL.EscapedPath(), "Encoded path is not the expected")
+		assert.Equal(t, "year=2024", r.URL.RawQuery, "Query is not the expected")
+	}))
+	defer server.Close()
+
+	client, err := web.NewClientBuilder().WithBaseURL(server.URL + "/api/").Build()
+	assert.Nil(t, err, "Unexpected error building client")
+
+	err = client.Get(context.Background(), "/files/reports%2F2024?year=2024", nil)
+	assert.Nil(t, err, "Unexpected error getting file")
+}
+
+func TestClient_DefaultHeadersStayOnBaseHost(t *testing.T) {
+	var otherHostCalls int32
+
+	otherHost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&otherHostCalls, 1)
+		assert.Empty(t, r.Header.Get("Authorization"), "Default headers should not leave the base URL host")
+	}))
+	defer otherHost.Close()
+
+	client, err := web.NewClientBuilder().
+		WithBaseURL("http://orders.internal").
+		WithHeader("Authorization", "Bearer secret").
+		Build()
+	assert.Nil(t, err, "Unexpected error building client")
+
+	err = client.Get(context.Background(), otherHost.URL+"/users", nil)
+	assert.NotNil(t, err, "Absolute URLs on other hosts should be rejected")
+
+	err = client.Get(context.Background(), "//"+otherHost.Listener.Addr().String()+"/users", nil)
+	assert.NotNil(t, err, "Scheme relative URLs on other hosts should be rejected")
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, otherHost.URL+"/users", nil)
+	assert.Nil(t, err, "Unexpected error creating request")
+
+	resp, err := client.Do(req)
+	assert.Nil(t, err, "Unexpected error sending request")
+	resp.Body.Close()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&otherHostCalls), "Only the request sent with Do should arrive")
+}
+
+func TestClientBuilder_Build(t *testing.T) {
+	_, err := web.NewClientBuilder().WithBaseURL("not a url").Build()
+
+	assert.NotNil(t, err, "Invalid base URL should be rejected")
+}
@@ -0,0 +1,339 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultCompressMinSize = 1024
+
+// defaultSkipContentTypes the media types that are already compressed, so compressing them again wastes CPU.
+var defaultSkipContentTypes = []string{
+	"image/*", "video/*", "audio/*", "font/woff", "font/woff2", "application/zip", "application/gzip",
+	"application/x-gzip", "application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/x-bzip2", "application/pdf", "application/octet-stream",
+}
+
+// CompressOptions the options of the compression middleware.
+type CompressOptions struct {
+	// Level the compression level, from flate.BestSpeed to flate.BestCompression. Zero means the default level.
+	Level int
+	// MinSize the minimum body size, in bytes, worth compressing. Zero means 1024.
+	MinSize int
+	// SkipContentTypes the media types never compressed, supporting type wildcards such as "image/*". Empty means
+	// the common images, videos, audios, fonts and archives.
+	SkipContentTypes []string
+}
+
+// compressor the compression middleware, holding the writer pools of its level.
+type compressor struct {
+	level     int
+	minSize   int
+	skipTypes []string
+	gzipPool  sync.Pool
+	flatePool sync.Pool
+}
+
+// Compress returns a middleware compressing the responses with gzip or deflate, whichever the client prefers in its
+// Accept-Encoding header, gzip winning ties. Bodies are buffered up to the minimum size before deciding, so small
+// responses, responses with a Content-Encoding and the skipped content types are sent as they are. Flushing a
+// response before reaching the minimum size compresses it, so streams keep being compressed. A flush before the first
+// write only defers the decision to that write, since the content type may not be known yet.
+// It panics if the level is not valid.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	theCompressor := &compressor{
+		level:     opts.Level,
+		minSize:   opts.MinSize,
+		skipTypes: opts.SkipContentTypes,
+	}
+
+	if theCompressor.level == 0 {
+		theCompressor.level = flate.DefaultCompression
+	}
+
+	if theCompressor.level < flate.HuffmanOnly || theCompressor.level > flate.BestCompression {
+		panic("web: compression level " + strconv.Itoa(opts.Level) + " is not valid")
+	}
+
+	if theCompressor.minSize <= 0 {
+		theCompressor.minSize = defaultCompressMinSize
+	}
+
+	if len(theCompressor.skipTypes) == 0 {
+		theCompressor.skipTypes = defaultSkipContentTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			writer := &compressWriter{ResponseWriter: w, compressor: theCompressor, encoding: encoding}
+
+			next.ServeHTTP(writer, r)
+
+			// Not deferred: when the handler panics the buffered body is dropped so Recoverer can still answer.
+			writer.close()
+		})
+	}
+}
+
+// negotiateEncoding returns gzip, deflate or an empty string when the client accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		quality := 1.0
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+
+			quality = parsed
+		}
+
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+func (theCompressor *compressor) skipped(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, skipType := range theCompressor.skipTypes {
+		if mediaTypeMatches(skipType, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (theCompressor *compressor) writer(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "gzip" {
+		if pooled, ok := theCompressor.gzipPool.Get().(*gzip.Writer); ok {
+			pooled.Reset(w)
+
+			return pooled
+		}
+
+		// The level was validated by Compress.
+		gzipWriter, _ := gzip.NewWriterLevel(w, theCompressor.level)
+
+		return gzipWriter
+	}
+
+	if pooled, ok := theCompressor.flatePool.Get().(*flate.Writer); ok {
+		pooled.Reset(w)
+
+		return pooled
+	}
+
+	flateWriter, _ := flate.NewWriter(w, theCompressor.level)
+
+	return flateWriter
+}
+
+func (theCompressor *compressor) release(writer io.WriteCloser) {
+	switch writer := writer.(type) {
+	case *gzip.Writer:
+		theCompressor.gzipPool.Put(writer)
+	case *flate.Writer:
+		theCompressor.flatePool.Put(writer)
+	}
+}
+
+// compressWriter buffers the beginning of the body until it can decide whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *compressor
+	encoding   string
+
+	status  int
+	buffer  []byte
+	flushed bool
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (writer *compressWriter) WriteHeader(status int) {
+	if writer.decided {
+		writer.ResponseWriter.WriteHeader(status)
+
+		return
+	}
+
+	if writer.status != 0 {
+		return
+	}
+
+	// Informational responses are sent right away and the final status is still expected.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		writer.ResponseWriter.WriteHeader(status)
+
+		return
+	}
+
+	writer.status = status
+}
+
+func (writer *compressWriter) Write(data []byte) (int, error) {
+	if !writer.decided {
+		writer.buffer = append(writer.buffer, data...)
+
+		if len(writer.buffer) < writer.compressor.minSize && (!writer.flushed || len(writer.buffer) == 0) {
+			return len(data), nil
+		}
+
+		if err := writer.decide(true); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	if writer.encoder != nil {
+		return writer.encoder.Write(data)
+	}
+
+	return writer.ResponseWriter.Write(data)
+}
+
+// Flush compresses the buffered body if it is eligible, whatever its size, and flushes it to the client. With nothing
+// buffered yet, the decision is left to the first write.
+func (writer *compressWriter) Flush() {
+	if !writer.decided {
+		writer.flushed = true
+
+		if len(writer.buffer) == 0 {
+			return
+		}
+
+		_ = writer.decide(true)
+	}
+
+	if flusher, ok := writer.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over to the handler, which then owns the response.
+func (writer *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, readWriter, err := hijacker.Hijack()
+	if err == nil {
+		writer.decided = true
+		writer.buffer = nil
+	}
+
+	return conn, readWriter, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (writer *compressWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// decide writes the header and the buffered body, compressing them if asked and the response is eligible.
+func (writer *compressWriter) decide(compress bool) error {
+	writer.decided = true
+
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+
+	header := writer.Header()
+	if header.Get("Content-Type") == "" && len(writer.buffer) > 0 {
+		header.Set("Content-Type", http.DetectContentType(writer.buffer))
+	}
+
+	compress = compress && len(writer.buffer) > 0 && writer.status != http.StatusNoContent &&
+		writer.status != http.StatusNotModified && writer.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		!writer.compressor.skipped(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", writer.encoding)
+		header.Del("Content-Length")
+		writer.encoder = writer.compressor.writer(writer.encoding, writer.ResponseWriter)
+	}
+
+	writer.ResponseWriter.WriteHeader(writer.status)
+
+	buffer := writer.buffer
+	writer.buffer = nil
+
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	var err error
+	if writer.encoder != nil {
+		_, err = writer.encoder.Write(buffer)
+	} else {
+		_, err = writer.ResponseWriter.Write(buffer)
+	}
+
+	return err
+}
+
+// close sends the bodies smaller than the minimum size as they are and finishes the compressed stream.
+func (writer *compressWriter) close() {
+	if !writer.decided {
+		if writer.status == 0 && len(writer.buffer) == 0 {
+			// The handler wrote nothing, net/http sends its implicit 200.
+			return
+		}
+
+		_ = writer.decide(false)
+	}
+
+	if writer.encoder != nil {
+		_ = writer.encoder.Close()
+		writer.compressor.release(writer.encoder)
+		writer.encoder = nil
+	}
+}
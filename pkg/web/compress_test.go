@@ -0,0 +1,182 @@
+package web_test
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestCompress(t *testing.T) {
+	largeBody := `{"items":"` + strings.Repeat("order ", 500) + `"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantEncoding   string
+	}{
+		{
+			name:           "Gzip",
+			acceptEncoding: "gzip, deflate",
+			contentType:    "application/json",
+			body:           largeBody,
+			wantEncoding:   "gzip",
+		},
+		{
+			name:           "Deflate preferred by quality",
+			acceptEncoding: "gzip;q=0.5, deflate",
+			contentType:    "application/json",
+			body:           largeBody,
+			wantEncoding:   "deflate",
+		},
+		{
+			name:           "Small body",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{"id":1}`,
+		},
+		{
+			name:           "Already compressed content type",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           largeBody,
+		},
+		{
+			name:           "Encoding not accepted",
+			acceptEncoding: "br, gzip;q=0",
+			contentType:    "application/json",
+			body:           largeBody,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compress := web.Compress(web.CompressOptions{})
+			handler := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusCreated)
+
+				// Write in chunks to cross the minimum size in the middle of a write.
+				for i := 0; i < len(tt.body); i += 100 {
+					_, _ = io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusCreated, recorder.Code, "Status is not the expected")
+			assert.Equal(t, tt.wantEncoding, recorder.Header().Get("Content-Encoding"), "Encoding is not the expected")
+			assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"), "Vary header is not the expected")
+
+			var reader io.Reader = recorder.Body
+
+			switch tt.wantEncoding {
+			case "gzip":
+				gzipReader, err := gzip.NewReader(recorder.Body)
+				assert.Nil(t, err, "Body should be gzipped")
+
+				reader = gzipReader
+			case "deflate":
+				reader = flate.NewReader(recorder.Body)
+			}
+
+			body, err := io.ReadAll(reader)
+			assert.Nil(t, err, "Error reading the body")
+			assert.Equal(t, tt.body, string(body), "Body is not the expected")
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := web.Compress(web.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.True(t, recorder.Flushed, "Response should be flushed")
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"), "Flushed streams should be compressed")
+
+	gzipReader, err := gzip.NewReader(recorder.Body)
+	assert.Nil(t, err, "Body should be gzipped")
+
+	body, err := io.ReadAll(gzipReader)
+	assert.Nil(t, err, "Error reading the body")
+	assert.Equal(t, "data: 1\n\n", string(body), "Body is not the expected")
+}
+
+func TestCompressFlushBeforeWrite(t *testing.T) {
+	handler := web.Compress(web.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: 1\n\n")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"), "Content type is not the expected")
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"), "Flushed streams should be compressed")
+
+	gzipReader, err := gzip.NewReader(recorder.Body)
+	assert.Nil(t, err, "Body should be gzipped")
+
+	body, err := io.ReadAll(gzipReader)
+	assert.Nil(t, err, "Error reading the body")
+	assert.Equal(t, "data: 1\n\n", string(body), "Body is not the expected")
+}
+
+// hijackRecorder a ResponseRecorder supporting hijacking.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (recorder *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	recorder.hijacked = true
+
+	return nil, nil, nil
+}
+
+func TestCompressHijack(t *testing.T) {
+	handler := web.Compress(web.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		assert.True(t, ok, "Hijacking should be supported")
+
+		_, _, err := hijacker.Hijack()
+		assert.Nil(t, err, "Error hijacking the connection")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	recorder := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(recorder, req)
+
+	assert.True(t, recorder.hijacked, "Connection should be hijacked")
+	assert.Empty(t, recorder.Header().Get("Content-Encoding"), "Hijacked responses should not be compressed")
+}
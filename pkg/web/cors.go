@@ -0,0 +1,255 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", RequestIDHeader}
+)
+
+// CORSOptions the options of the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins the origins allowed to call the API: "*" for any origin, exact origins such as
+	// "https://app.voras.com" or wildcard subdomain patterns such as "https://*.voras.com".
+	AllowedOrigins []string
+	// AllowedMethods the methods allowed in cross-origin requests. Empty means GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders the request headers allowed in cross-origin requests. Empty means Accept, Authorization,
+	// Content-Type and X-Request-ID, "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders the response headers the browser exposes to the client.
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and authorization headers. It cannot be combined with the "*" origin, since
+	// that would let any site make credentialed calls; list the trusted origins instead.
+	AllowCredentials bool
+	// MaxAge how long browsers may cache the preflight response. Zero omits the header.
+	MaxAge time.Duration
+}
+
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+type cors struct {
+	anyOrigin      bool
+	origins        map[string]bool
+	patterns       []originPattern
+	methods        map[string]bool
+	allowedMethods string
+	anyHeader      bool
+	headers        map[string]bool
+	allowedHeaders string
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+// CORS returns a middleware handling cross-origin requests. Preflight requests are answered with a 204 and never
+// reach the handlers, and the responses of disallowed origins carry no CORS headers so browsers block them.
+// Mount it with Use on the router or on a chi Route sub-router: routes registered through Group or With only run
+// their middlewares for the methods they declare, so preflight OPTIONS requests would be rejected with a 405.
+// It panics if an origin pattern has more than one wildcard or if any origin is allowed along with credentials.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	theCORS := newCORS(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !theCORS.originAllowed(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+
+					return
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if preflight {
+				theCORS.handlePreflight(w, r, origin)
+
+				return
+			}
+
+			theCORS.setOrigin(header, origin)
+
+			if theCORS.exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", theCORS.exposedHeaders)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newCORS(opts CORSOptions) *cors {
+	theCORS := &cors{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		credentials: opts.AllowCredentials,
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+
+		switch strings.Count(origin, "*") {
+		case 0:
+			theCORS.origins[origin] = true
+		case 1:
+			if origin == "*" {
+				theCORS.anyOrigin = true
+
+				continue
+			}
+
+			wildcard := strings.Index(origin, "*")
+			theCORS.patterns = append(theCORS.patterns, originPattern{
+				prefix: origin[:wildcard],
+				suffix: origin[wildcard+1:],
+			})
+		default:
+			panic("web: CORS origin " + origin + " cannot have more than one wildcard")
+		}
+	}
+
+	if theCORS.anyOrigin && theCORS.credentials {
+		panic(`web: CORS cannot allow credentials for the "*" origin`)
+	}
+
+	allowedMethods := opts.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = defaultCORSMethods
+	}
+
+	methods := make([]string, 0, len(allowedMethods))
+	for _, method := range allowedMethods {
+		method = strings.ToUpper(method)
+		theCORS.methods[method] = true
+		methods = append(methods, method)
+	}
+
+	theCORS.allowedMethods = strings.Join(methods, ", ")
+
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	for _, allowedHeader := range headers {
+		if allowedHeader == "*" {
+			theCORS.anyHeader = true
+		}
+
+		theCORS.headers[http.CanonicalHeaderKey(allowedHeader)] = true
+	}
+
+	theCORS.allowedHeaders = strings.Join(headers, ", ")
+	theCORS.exposedHeaders = strings.Join(opts.ExposedHeaders, ", ")
+
+	if opts.MaxAge > 0 {
+		theCORS.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return theCORS
+}
+
+func (theCORS *cors) originAllowed(origin string) bool {
+	if theCORS.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if theCORS.origins[origin] {
+		return true
+	}
+
+	for _, pattern := range theCORS.patterns {
+		// The wildcard must match at least one character so "https://.voras.com" is not allowed.
+		if len(origin) > len(pattern.prefix)+len(pattern.suffix) && strings.HasPrefix(origin, pattern.prefix) &&
+			strings.HasSuffix(origin, pattern.suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (theCORS *cors) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	header := w.Header()
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+
+	if !theCORS.methods[method] || !theCORS.headersAllowed(requestHeaders) {
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	theCORS.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", theCORS.allowedMethods)
+
+	if theCORS.anyHeader {
+		if requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else {
+		header.Set("Access-Control-Allow-Headers", theCORS.allowedHeaders)
+	}
+
+	if theCORS.maxAge != "" {
+		header.Set("Access-Control-Max-Age", theCORS.maxAge)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (theCORS *cors) headersAllowed(requestHeaders string) bool {
+	if theCORS.anyHeader {
+		return true
+	}
+
+	for _, requestHeader := range strings.Split(requestHeaders, ",") {
+		requestHeader = strings.TrimSpace(requestHeader)
+		if requestHeader != "" && !theCORS.headers[http.CanonicalHeaderKey(requestHeader)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (theCORS *cors) setOrigin(header http.Header, origin string) {
+	if theCORS.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+
+	if theCORS.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,140 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestCORS(t *testing.T) {
+	router := chi.NewRouter()
+	router.Route("/orders", func(r chi.Router) {
+		r.Use(web.CORS(web.CORSOptions{
+			AllowedOrigins:   []string{"https://app.voras.com", "https://*.voras.io"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+			ExposedHeaders:   []string{"X-Total-Count"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		}))
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "Simple request from an allowed origin",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://app.voras.com"},
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.voras.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total-Count",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:       "Simple request from a wildcard subdomain",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://admin.voras.io"},
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://admin.voras.io",
+			},
+		},
+		{
+			name:       "Simple request from a disallowed origin",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://voras.io.evil.com"},
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "Preflight request",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.voras.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.voras.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Accept, Authorization, Content-Type, X-Request-ID",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "Preflight request with a disallowed method",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.voras.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, recorder.Header().Get(name), "Header %s is not the expected", name)
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	handler := web.CORS(web.CORSOptions{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://anywhere.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"), "Any origin should be allowed")
+	assert.Equal(t, "X-Custom", recorder.Header().Get("Access-Control-Allow-Headers"),
+		"Requested headers should be allowed")
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		recorder.Header().Values("Vary"), "Vary headers are not the expected")
+}
+
+func TestCORSAnyOriginWithCredentials(t *testing.T) {
+	assert.Panics(t, func() {
+		web.CORS(web.CORSOptions{AllowedOrigins: []string{"https://app.voras.com", "*"}, AllowCredentials: true})
+	}, "Credentials should not be allowed for any origin")
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+// DecodeOptions the options used to decode JSON request bodies.
+type DecodeOptions struct {
+	// MaxBytes the maximum size of the body. Zero means 1MB.
+	MaxBytes int64
+	// DisallowUnknownFields rejects bodies with fields not present in the destination.
+	DisallowUnknownFields bool
+	// SkipValidation disables the validate struct tag rules.
+	SkipValidation bool
+}
+
+// DecodeJSON decodes the JSON request body into dst and validates it using the default options.
+// It returns a *RequestError for malformed requests and a *ValidationError listing every invalid field.
+func DecodeJSON(r *http.Request, dst interface{}) error {
+	return DecodeJSONWithOptions(r, dst, DecodeOptions{})
+}
+
+// DecodeJSONWithOptions decodes the JSON request body into dst and validates it using the given options.
+func DecodeJSONWithOptions(r *http.Request, dst interface{}, opts DecodeOptions) error {
+	if err := checkJSONContentType(r.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+
+	if r.Body == nil {
+		return &RequestError{Status: http.StatusBadRequest, Message: "request body cannot be empty"}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBytes))
+	if opts.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return decodeError(err)
+		}
+
+		return &RequestError{Status: http.StatusBadRequest, Message: "request body must contain a single JSON value"}
+	}
+
+	if opts.SkipValidation {
+		return nil
+	}
+
+	return Validate(dst)
+}
+
+func checkJSONContentType(contentType string) error {
+	if contentType == "" {
+		return &RequestError{Status: http.StatusUnsupportedMediaType, Message: "Content-Type header is required"}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return &RequestError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Content-Type %q is not supported, use application/json", contentType),
+		}
+	}
+
+	return nil
+}
+
+// decodeError turns the JSON decoding errors into request errors with a client friendly message.
+func decodeError(err error) error {
+	var (
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		maxBytesErr  *http.MaxBytesError
+		invalidErr   *json.InvalidUnmarshalError
+		unknownField = "json: unknown field "
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return &RequestError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("request body contains malformed JSON at position %d", syntaxErr.Offset),
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &RequestError{Status: http.StatusBadRequest, Message: "request body contains malformed JSON"}
+	case errors.As(err, &typeErr):
+		return &RequestError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("request body field %q must be a %s", typeErr.Field, typeErr.Type),
+		}
+	case strings.HasPrefix(err.Error(), unknownField):
+		field := strings.TrimPrefix(err.Error(), unknownField)
+
+		return &RequestError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("request body contains unknown field %s", field),
+		}
+	case errors.Is(err, io.EOF):
+		return &RequestError{Status: http.StatusBadRequest, Message: "request body cannot be empty"}
+	case errors.As(err, &maxBytesErr):
+		return &RequestError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit),
+		}
+	case errors.As(err, &invalidErr):
+		return err
+	default:
+		return &RequestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("request body is not valid: %v", err)}
+	}
+}
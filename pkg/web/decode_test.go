@@ -0,0 +1,154 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type address struct {
+	Street string `json:"street" validate:"required"`
+}
+
+type signUpRequest struct {
+	Name     string    `json:"name" validate:"required,min=2,max=10"`
+	Email    string    `json:"email" validate:"required,email"`
+	Age      int       `json:"age" validate:"min=18"`
+	Role     string    `json:"role" validate:"enum=admin|user"`
+	Code     string    `json:"code" validate:"len=3,regex=^[A-Z]{2,3}$"`
+	Tags     []string  `json:"tags" validate:"max=2"`
+	Address  *address  `json:"address" validate:"required"`
+	Contacts []address `json:"contacts"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		opts        web.DecodeOptions
+		wantStatus  int
+		wantFields  []string
+	}{
+		{
+			name:        "Valid body is decoded",
+			contentType: "application/json; charset=utf-8",
+			body: `{"name":"John","email":"john@mail.com","age":20,"role":"admin","code":"ARG",` +
+				`"address":{"street":"Main"}}`,
+		},
+		{
+			name:        "Missing Content-Type is rejected",
+			contentType: "",
+			body:        `{}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Unsupported Content-Type is rejected",
+			contentType: "text/plain",
+			body:        `{}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Malformed JSON is rejected",
+			contentType: "application/json",
+			body:        `{"name":`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Too large body is rejected",
+			contentType: "application/json",
+			body:        `{"name":"` + strings.Repeat("a", 100) + `"}`,
+			opts:        web.DecodeOptions{MaxBytes: 50},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "Unknown fields are rejected when disallowed",
+			contentType: "application/json",
+			body:        `{"unknown":1}`,
+			opts:        web.DecodeOptions{DisallowUnknownFields: true},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "Every invalid field is reported",
+			contentType: "application/json",
+			body: `{"name":"J","email":"not-an-email","age":10,"role":"root","code":"ar","tags":["a","b","c"],
+				"contacts":[{"street":""}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []string{"name", "email", "age", "role", "code", "tags", "address", "contacts[0].street"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			dst := signUpRequest{}
+			err := web.DecodeJSONWithOptions(req, &dst, tt.opts)
+
+			if tt.wantStatus == 0 {
+				assert.Nil(t, err, "Unexpected error decoding body")
+
+				return
+			}
+
+			var statusCoder web.StatusCoder
+			assert.True(t, errors.As(err, &statusCoder), "Error should carry a status code")
+			assert.Equal(t, tt.wantStatus, statusCoder.StatusCode(), "Status is not the expected")
+
+			if tt.wantFields != nil {
+				var validationErr *web.ValidationError
+				assert.True(t, errors.As(err, &validationErr), "Error should be a validation error")
+
+				fields := make([]string, len(validationErr.Fields))
+				for i, field := range validationErr.Fields {
+					fields[i] = field.Field
+				}
+
+				assert.Equal(t, tt.wantFields, fields, "Invalid fields are not the expected")
+			}
+		})
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Status coder errors expose their message",
+			err:        &web.RequestError{Status: http.StatusBadRequest, Message: "bad request"},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"status":400,"message":"bad request"}`,
+		},
+		{
+			name:       "Other errors are hidden behind an internal server error",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"status":500,"message":"Internal Server Error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			err := web.EncodeError(recorder, tt.err)
+
+			assert.Nil(t, err, "Unexpected error encoding error")
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+			assert.JSONEq(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+		})
+	}
+}
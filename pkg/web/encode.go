@@ -0,0 +1,484 @@
+package web
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotEncodable is returned by encoders that cannot represent a value in their media type, so Encode moves on to
+// the next acceptable one.
+var ErrNotEncodable = errors.New("value cannot be encoded in the media type")
+
+// EncoderFunc writes v to w in the media type the encoder is registered for.
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+type registeredEncoder struct {
+	mediaType   string
+	contentType string
+	encode      EncoderFunc
+}
+
+type acceptRange struct {
+	mediaType   string
+	quality     float64
+	specificity int
+}
+
+var (
+	encodersMutex sync.RWMutex
+	encoders      = []registeredEncoder{
+		{mediaType: "application/json", contentType: "application/json; charset=utf-8", encode: encodeJSONBody},
+		{mediaType: "application/xml", contentType: "application/xml; charset=utf-8", encode: encodeXMLBody},
+		{mediaType: "text/csv", contentType: "text/csv; charset=utf-8", encode: encodeCSVBody},
+		{mediaType: "text/plain", contentType: "text/plain; charset=utf-8", encode: encodeTextBody},
+	}
+)
+
+// RegisterEncoder registers the encoder of a content type such as "application/yaml", replacing the encoder already
+// registered for the same media type. When the client accepts several media types with the same preference, the
+// encoders registered first win, JSON being the first one.
+// It panics if the content type is not valid.
+func RegisterEncoder(contentType string, encoder EncoderFunc) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || encoder == nil {
+		panic("web: encoder content type " + contentType + " is not valid")
+	}
+
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+
+	registered := registeredEncoder{mediaType: mediaType, contentType: contentType, encode: encoder}
+
+	for i := range encoders {
+		if encoders[i].mediaType == mediaType {
+			encoders[i] = registered
+
+			return
+		}
+	}
+
+	encoders = append(encoders, registered)
+}
+
+// Encode serializes the response in the media type negotiated with the Accept header of the request: JSON, XML,
+// CSV for slices of structs, plain text or any registered with RegisterEncoder. JSON is used when the request has
+// no Accept header. Requests accepting none of the media types able to encode the response get a JSON 406.
+// As EncodeJSON, it applies the headers of Headerer responses and writes no body for 204 responses.
+func Encode(w http.ResponseWriter, r *http.Request, v interface{}, code int) error {
+	if code == http.StatusNoContent {
+		applyHeaders(w, v)
+		w.WriteHeader(code)
+
+		return nil
+	}
+
+	candidates := negotiate(r.Header.Get("Accept"))
+	buffer := &bytes.Buffer{}
+
+	for _, candidate := range candidates {
+		buffer.Reset()
+
+		if err := candidate.encode(buffer, v); err != nil {
+			if errors.Is(err, ErrNotEncodable) {
+				continue
+			}
+
+			return err
+		}
+
+		applyHeaders(w, v)
+		w.Header().Set("Content-Type", candidate.contentType)
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(code)
+
+		_, err := w.Write(buffer.Bytes())
+
+		return err
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	return EncodeJSON(w, ErrorResponse{
+		Status:  http.StatusNotAcceptable,
+		Message: "none of the accepted media types can represent the response",
+	}, http.StatusNotAcceptable)
+}
+
+// negotiate returns the encoders acceptable for the Accept header, the preferred ones first.
+func negotiate(accept string) []registeredEncoder {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+
+	if strings.TrimSpace(accept) == "" {
+		return append([]registeredEncoder(nil), encoders...)
+	}
+
+	ranges := parseAccept(accept)
+
+	candidates := make([]registeredEncoder, 0, len(encoders))
+	qualities := make(map[string]float64, len(encoders))
+
+	for _, encoder := range encoders {
+		// The most specific range matching the media type decides its quality.
+		best := acceptRange{specificity: -1}
+
+		for _, theRange := range ranges {
+			if theRange.specificity > best.specificity && mediaTypeMatches(theRange.mediaType, encoder.mediaType) {
+				best = theRange
+			}
+		}
+
+		if best.specificity >= 0 && best.quality > 0 {
+			candidates = append(candidates, encoder)
+			qualities[encoder.mediaType] = best.quality
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return qualities[candidates[i].mediaType] > qualities[candidates[j].mediaType]
+	})
+
+	return candidates
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		theRange := acceptRange{mediaType: mediaType, quality: 1, specificity: 2}
+
+		switch {
+		case mediaType == "*/*":
+			theRange.specificity = 0
+		case strings.HasSuffix(mediaType, "/*"):
+			theRange.specificity = 1
+		}
+
+		if q, ok := params["q"]; ok {
+			quality, err := strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+
+			theRange.quality = quality
+		}
+
+		ranges = append(ranges, theRange)
+	}
+
+	return ranges
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+}
+
+func encodeJSONBody(w io.Writer, v interface{}) error {
+	jsonData, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(jsonData)
+
+	return err
+}
+
+// encodeXMLBody encodes v as XML. Slices are wrapped in an items element so the document has a single root.
+func encodeXMLBody(w io.Writer, v interface{}) error {
+	switch v.(type) {
+	case []byte, io.Reader:
+		return ErrNotEncodable
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	value := reflect.ValueOf(v)
+
+	var err error
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		err = encodeXMLItems(encoder, value)
+	} else {
+		err = encoder.Encode(v)
+	}
+
+	var unsupported *xml.UnsupportedTypeError
+	if errors.As(err, &unsupported) {
+		return fmt.Errorf("%w: %s", ErrNotEncodable, err.Error())
+	}
+
+	return err
+}
+
+func encodeXMLItems(encoder *xml.Encoder, items reflect.Value) error {
+	root := xml.StartElement{Name: xml.Name{Local: "items"}}
+	if err := encoder.EncodeToken(root); err != nil {
+		return err
+	}
+
+	for i := 0; i < items.Len(); i++ {
+		if err := encoder.Encode(items.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.EncodeToken(root.End()); err != nil {
+		return err
+	}
+
+	return encoder.Flush()
+}
+
+// encodeCSVBody encodes a slice of structs, or a single struct, as CSV with a header row. Columns are named after
+// the csv tag of the fields, falling back to the json tag and the field name, and "-" skips a field.
+func encodeCSVBody(w io.Writer, v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	if !value.IsValid() {
+		return ErrNotEncodable
+	}
+
+	rows := []reflect.Value{value}
+
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return ErrNotEncodable
+		}
+
+		rows = make([]reflect.Value, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			rows = append(rows, value.Index(i))
+		}
+	}
+
+	elemType := value.Type()
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		elemType = elemType.Elem()
+	}
+
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+
+	if elemType.Kind() != reflect.Struct {
+		return ErrNotEncodable
+	}
+
+	columns := csvColumns(elemType, nil)
+	writer := csv.NewWriter(w)
+
+	header := make([]string, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+
+	for _, row := range rows {
+		if row.Kind() == reflect.Pointer {
+			if row.IsNil() {
+				continue
+			}
+
+			row = row.Elem()
+		}
+
+		for i, column := range columns {
+			field, err := row.FieldByIndexErr(column.index)
+			if err != nil {
+				// A nil embedded pointer leaves its fields empty.
+				record[i] = ""
+
+				continue
+			}
+
+			record[i] = formatCSVValue(field)
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+func csvColumns(structType reflect.Type, parent []int) []csvColumn {
+	var columns []csvColumn
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(append([]int(nil), parent...), i)
+
+		name, tagged := csvColumnName(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		// Untagged embedded structs are flattened, as encoding/json does.
+		if field.Anonymous && !tagged && fieldType.Kind() == reflect.Struct {
+			columns = append(columns, csvColumns(fieldType, index)...)
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		columns = append(columns, csvColumn{name: name, index: index})
+	}
+
+	return columns
+}
+
+func csvColumnName(field reflect.StructField) (string, bool) {
+	for _, key := range []string{"csv", "json"} {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			if name := strings.Split(tag, ",")[0]; name != "" {
+				return name, true
+			}
+		}
+	}
+
+	return field.Name, false
+}
+
+// formatCSVValue formats a field the way it is represented in JSON, without the quotes of strings.
+func formatCSVValue(value reflect.Value) string {
+	for value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return ""
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Pointer && value.IsNil() {
+		return ""
+	}
+
+	if text, ok := formatText(addressable(value).Interface()); ok {
+		return text
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+
+	return string(encoded)
+}
+
+// addressable returns a pointer to a copy of the value so the methods with pointer receivers are available.
+func addressable(value reflect.Value) reflect.Value {
+	if value.Kind() == reflect.Pointer {
+		return value
+	}
+
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+
+	return pointer
+}
+
+func encodeTextBody(w io.Writer, v interface{}) error {
+	text, ok := formatText(v)
+	if !ok {
+		return ErrNotEncodable
+	}
+
+	_, err := io.WriteString(w, text)
+
+	return err
+}
+
+// formatText returns the textual representation of scalars, strings, errors and types implementing json.Marshaler
+// as a JSON string, encoding.TextMarshaler or fmt.Stringer.
+func formatText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case error:
+		return v.Error(), true
+	case json.Marshaler:
+		encoded, err := v.MarshalJSON()
+
+		var text string
+		if err == nil && json.Unmarshal(encoded, &text) == nil {
+			return text, true
+		}
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return string(text), true
+		}
+	case fmt.Stringer:
+		return v.String(), true
+	}
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), true
+	default:
+		return "", false
+	}
+}
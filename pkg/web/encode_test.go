@@ -0,0 +1,154 @@
+package web_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type encodedOrder struct {
+	ID        int       `json:"id" xml:"id"`
+	Customer  string    `json:"customer" xml:"customer" csv:"customer_name"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	Internal  string    `json:"-" xml:"-"`
+}
+
+type headeredOrder struct {
+	encodedOrder
+}
+
+func (order headeredOrder) Headers() http.Header {
+	return http.Header{"X-Order-Id": []string{"1"}}
+}
+
+func TestEncode(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	orders := []encodedOrder{
+		{ID: 1, Customer: "Acme", CreatedAt: createdAt, Internal: "secret"},
+		{ID: 2, Customer: "Voras, Inc", CreatedAt: createdAt},
+	}
+
+	tests := []struct {
+		name            string
+		accept          string
+		value           interface{}
+		code            int
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "JSON by default",
+			value:           orders[0],
+			code:            http.StatusOK,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"id":1,"customer":"Acme","created_at":"2024-03-01T10:00:00Z"}`,
+		},
+		{
+			name:            "XML list",
+			accept:          "application/xml",
+			value:           orders[:1],
+			code:            http.StatusOK,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<items><encodedOrder><id>1</id>` +
+				`<customer>Acme</customer><created_at>2024-03-01T10:00:00Z</created_at></encodedOrder></items>`,
+		},
+		{
+			name:            "CSV preferred by quality",
+			accept:          "application/json;q=0.5, text/csv",
+			value:           orders,
+			code:            http.StatusOK,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "id,customer_name,created_at\n1,Acme,2024-03-01T10:00:00Z\n" +
+				"2,\"Voras, Inc\",2024-03-01T10:00:00Z\n",
+		},
+		{
+			name:            "Plain text",
+			accept:          "text/plain",
+			value:           "pong",
+			code:            http.StatusOK,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "pong",
+		},
+		{
+			name:            "Falls back to the next acceptable media type",
+			accept:          "text/csv, application/json;q=0.1",
+			value:           map[string]int{"total": 2},
+			code:            http.StatusOK,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"total":2}`,
+		},
+		{
+			name:            "Not acceptable",
+			accept:          "image/png",
+			value:           orders,
+			code:            http.StatusOK,
+			wantStatus:      http.StatusNotAcceptable,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"status":406,"message":"none of the accepted media types can represent the response"}`,
+		},
+		{
+			name:       "No content",
+			accept:     "text/csv",
+			value:      nil,
+			code:       http.StatusNoContent,
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			assert.Nil(t, web.Encode(recorder, req, tt.value, tt.code), "Encode should not fail")
+
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+			assert.Equal(t, tt.wantContentType, recorder.Header().Get("Content-Type"),
+				"Content type is not the expected")
+			assert.Equal(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+		})
+	}
+}
+
+func TestEncodeHeaderer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	recorder := httptest.NewRecorder()
+
+	assert.Nil(t, web.Encode(recorder, req, headeredOrder{encodedOrder{ID: 1}}, http.StatusOK),
+		"Encode should not fail")
+
+	assert.Equal(t, "1", recorder.Header().Get("X-Order-Id"), "Headerer headers should be applied")
+	assert.Equal(t, "Accept", recorder.Header().Get("Vary"), "Vary header is not the expected")
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	web.RegisterEncoder("application/vnd.voras+json", func(w io.Writer, v interface{}) error {
+		return json.NewEncoder(w).Encode(map[string]interface{}{"data": v})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("Accept", "application/vnd.voras+json")
+	recorder := httptest.NewRecorder()
+
+	assert.Nil(t, web.Encode(recorder, req, []int{1, 2}, http.StatusOK), "Encode should not fail")
+
+	assert.Equal(t, "application/vnd.voras+json", recorder.Header().Get("Content-Type"),
+		"Content type is not the expected")
+	assert.JSONEq(t, `{"data":[1,2]}`, recorder.Body.String(), "Body is not the expected")
+}
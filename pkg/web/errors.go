@@ -0,0 +1,64 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StatusCoder is implemented by errors carrying the HTTP status code of their response.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// ErrorResponse the JSON body of the error responses.
+type ErrorResponse struct {
+	Status  int          `json:"status"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// RequestError an error caused by a malformed request.
+type RequestError struct {
+	Status  int
+	Message string
+}
+
+func (err *RequestError) Error() string {
+	return err.Message
+}
+
+func (err *RequestError) StatusCode() int {
+	return err.Status
+}
+
+// NewErrorResponse builds the error response body for the given error.
+// Errors implementing StatusCoder expose their message, any other error is reported as an internal server error
+// without details.
+func NewErrorResponse(err error) ErrorResponse {
+	var statusCoder StatusCoder
+	if !errors.As(err, &statusCoder) {
+		return ErrorResponse{
+			Status:  http.StatusInternalServerError,
+			Message: http.StatusText(http.StatusInternalServerError),
+		}
+	}
+
+	response := ErrorResponse{
+		Status:  statusCoder.StatusCode(),
+		Message: err.Error(),
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		response.Fields = validationErr.Fields
+	}
+
+	return response
+}
+
+// EncodeError writes the error response for the given error as JSON to the ResponseWriter.
+func EncodeError(w http.ResponseWriter, err error) error {
+	response := NewErrorResponse(err)
+
+	return EncodeJSON(w, response, response.Status)
+}
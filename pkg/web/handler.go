@@ -0,0 +1,195 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+// HandlerOptions the options of the typed handler adapter.
+type HandlerOptions struct {
+	// Status the status of successful responses. Zero means 200, or 204 when the response type is an empty struct.
+	Status int
+	// Decode the options used to decode the JSON body. SkipValidation also skips the validation of the parameters.
+	Decode DecodeOptions
+	// Negotiate encodes the responses with Encode instead of EncodeJSON, negotiating the media type.
+	Negotiate bool
+	// MapError converts the errors of the handlers, such as domain or database errors, to errors implementing
+	// StatusCoder. Errors left without a status are answered with a 500 and logged.
+	MapError func(err error) error
+}
+
+// typedHandler the typed handler adapter, used as the Class tag of the log lines.
+type typedHandler[Req, Resp any] struct {
+	fn     func(ctx context.Context, req Req) (Resp, error)
+	opts   HandlerOptions
+	status int
+	body   bool
+}
+
+// Handle adapts a typed function to an http.HandlerFunc. The request struct is decoded from the JSON body when it
+// has JSON fields and the request has a body, its param and query fields are bound as BindParams does, and it is
+// validated once complete. The response is encoded with the configured status, and every error, from binding or
+// from the function, is answered with EncodeError after MapError.
+//
+//	router.Patch("/orders/{id}", web.Handle(service.UpdateOrder, web.HandlerOptions{MapError: mapOrderErrors}))
+func Handle[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error),
+	opts HandlerOptions) http.HandlerFunc {
+	return newTypedHandler(fn, opts).ServeHTTP
+}
+
+// HandleDocumented is Handle returning a handler documented for GenerateOpenAPI, with the request and response types
+// and the status of the adapter filled into the operation.
+func HandleDocumented[Req, Resp any](operation Operation, fn func(ctx context.Context, req Req) (Resp, error),
+	opts HandlerOptions) http.Handler {
+	handler := newTypedHandler(fn, opts)
+
+	var (
+		req  Req
+		resp Resp
+	)
+
+	if reflect.TypeOf(req) != nil && !isEmptyStruct(reflect.TypeOf(req)) {
+		operation.Request = req
+	}
+
+	if handler.status != http.StatusNoContent {
+		operation.Response = resp
+	}
+
+	operation.Status = handler.status
+
+	return Document(operation, handler)
+}
+
+func newTypedHandler[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error),
+	opts HandlerOptions) *typedHandler[Req, Resp] {
+	handler := &typedHandler[Req, Resp]{fn: fn, opts: opts, status: opts.Status}
+
+	var (
+		req  Req
+		resp Resp
+	)
+
+	if handler.status == 0 {
+		handler.status = http.StatusOK
+		if responseType := reflect.TypeOf(resp); responseType != nil && isEmptyStruct(responseType) {
+			handler.status = http.StatusNoContent
+		}
+	}
+
+	if requestType := reflect.TypeOf(req); requestType != nil {
+		for requestType.Kind() == reflect.Pointer {
+			requestType = requestType.Elem()
+		}
+
+		handler.body = requestType.Kind() == reflect.Struct && !isEmptyStruct(requestType) && hasBody(requestType)
+	}
+
+	return handler
+}
+
+func (handler *typedHandler[Req, Resp]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := handler.bind(r)
+	if err != nil {
+		handler.encodeError(w, r, err)
+
+		return
+	}
+
+	resp, err := handler.fn(r.Context(), req)
+	if err != nil {
+		handler.encodeError(w, r, err)
+
+		return
+	}
+
+	if handler.opts.Negotiate {
+		err = Encode(w, r, resp, handler.status)
+	} else {
+		err = EncodeJSON(w, resp, handler.status)
+	}
+
+	if err != nil {
+		log.FromContext(r.Context()).Error(handler, nil, err, "Error encoding response")
+	}
+}
+
+// bind decodes the body before binding the parameters. The parameter fields set by the body are reset first, so they
+// only ever hold what the client sent in the URL or the query string.
+func (handler *typedHandler[Req, Resp]) bind(r *http.Request) (Req, error) {
+	var req Req
+
+	value := reflect.ValueOf(&req).Elem()
+	if value.Kind() == reflect.Pointer {
+		value.Set(reflect.New(value.Type().Elem()))
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return req, nil
+	}
+
+	if handler.body && r.Body != nil && r.Body != http.NoBody {
+		decodeOpts := handler.opts.Decode
+		decodeOpts.SkipValidation = true
+
+		if err := DecodeJSONWithOptions(r, value.Addr().Interface(), decodeOpts); err != nil {
+			return req, err
+		}
+
+		resetParams(value)
+	}
+
+	if err := bindStruct(r, value); err != nil {
+		return req, err
+	}
+
+	if handler.opts.Decode.SkipValidation {
+		return req, nil
+	}
+
+	return req, Validate(value.Addr().Interface())
+}
+
+func (handler *typedHandler[Req, Resp]) encodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if handler.opts.MapError != nil {
+		err = handler.opts.MapError(err)
+	}
+
+	var statusCoder StatusCoder
+	if !errors.As(err, &statusCoder) {
+		log.FromContext(r.Context()).Error(handler, nil, err, "Error handling request")
+	}
+
+	_ = EncodeError(w, err)
+}
+
+// resetParams zeroes the fields bound from the URL or the query string, including the ones of embedded structs.
+func resetParams(value reflect.Value) {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			resetParams(value.Field(i))
+
+			continue
+		}
+
+		if source, _ := fieldParamSource(field); source != "" {
+			value.Field(i).SetZero()
+		}
+	}
+}
+
+func isEmptyStruct(valueType reflect.Type) bool {
+	return valueType.Kind() == reflect.Struct && valueType.NumField() == 0
+}
@@ -0,0 +1,159 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+var errOrderNotFound = errors.New("order not found")
+
+type renameOrderRequest struct {
+	ID     int    `param:"id"`
+	Notify bool   `query:"notify"`
+	Name   string `json:"name" validate:"required,max=20"`
+}
+
+type renamedOrder struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Notify bool   `json:"notify"`
+}
+
+func renameOrder(ctx context.Context, req renameOrderRequest) (renamedOrder, error) {
+	switch req.ID {
+	case 404:
+		return renamedOrder{}, errOrderNotFound
+	case 500:
+		return renamedOrder{}, errors.New("connection refused")
+	}
+
+	return renamedOrder{ID: req.ID, Name: req.Name, Notify: req.Notify}, nil
+}
+
+func TestHandle(t *testing.T) {
+	mapError := func(err error) error {
+		if errors.Is(err, errOrderNotFound) {
+			return &web.RequestError{Status: http.StatusNotFound, Message: err.Error()}
+		}
+
+		return err
+	}
+
+	router := chi.NewRouter()
+	router.Patch("/orders/{id}", web.Handle(renameOrder, web.HandlerOptions{MapError: mapError}))
+	router.Delete("/orders/{id}", web.Handle(func(ctx context.Context, req struct {
+		ID int `param:"id"`
+	}) (struct{}, error) {
+		return struct{}{}, nil
+	}, web.HandlerOptions{}))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Bound and encoded",
+			method:     http.MethodPatch,
+			target:     "/orders/7?notify=true",
+			body:       `{"name":"Renamed","id":99}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":7,"name":"Renamed","notify":true}`,
+		},
+		{
+			name:       "Query parameter is not set by the body",
+			method:     http.MethodPatch,
+			target:     "/orders/7",
+			body:       `{"name":"Renamed","notify":true}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":7,"name":"Renamed","notify":false}`,
+		},
+		{
+			name:       "Invalid parameter",
+			method:     http.MethodPatch,
+			target:     "/orders/x",
+			body:       `{"name":"Renamed"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"status":400,"message":"url parameter \"id\" must be an integer"}`,
+		},
+		{
+			name:       "Invalid body",
+			method:     http.MethodPatch,
+			target:     "/orders/7",
+			body:       `{"name":""}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"status":400,"message":"validation failed: name is required",` +
+				`"fields":[{"field":"name","rule":"required","message":"name is required"}]}`,
+		},
+		{
+			name:       "Mapped error",
+			method:     http.MethodPatch,
+			target:     "/orders/404",
+			body:       `{"name":"Renamed"}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"status":404,"message":"order not found"}`,
+		},
+		{
+			name:       "Unexpected error",
+			method:     http.MethodPatch,
+			target:     "/orders/500",
+			body:       `{"name":"Renamed"}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"status":500,"message":"Internal Server Error"}`,
+		},
+		{
+			name:       "Empty response",
+			method:     http.MethodDelete,
+			target:     "/orders/7",
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+			} else {
+				assert.Empty(t, recorder.Body.String(), "Body should be empty")
+			}
+		})
+	}
+}
+
+func TestHandleDocumented(t *testing.T) {
+	router := chi.NewRouter()
+	router.Method(http.MethodPatch, "/orders/{id}", web.HandleDocumented(web.Operation{Summary: "Rename an order"},
+		renameOrder, web.HandlerOptions{Status: http.StatusAccepted}))
+
+	document, err := web.GenerateOpenAPI(router, web.OpenAPIInfo{Title: "Orders"})
+	assert.Nil(t, err, "Document should be generated")
+
+	operation := document.Paths["/orders/{id}"]["patch"]
+	assert.Equal(t, "Rename an order", operation.Summary, "Summary is not the expected")
+	assert.Equal(t, "#/components/schemas/renamedOrder",
+		operation.Responses["202"].Content["application/json"].Schema.Ref, "Response is not the expected")
+	assert.Equal(t, "#/components/schemas/renameOrderRequest",
+		operation.RequestBody.Content["application/json"].Schema.Ref, "Request body is not the expected")
+}
@@ -0,0 +1,418 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	// IdempotencyKeyHeader the header carrying the client generated key of a retriable request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader the header marking the responses replayed from the idempotency store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyLockTimeout = time.Minute
+	defaultIdempotencyMaxBody     = 1 << 20
+	defaultIdempotencyMaxResponse = 1 << 20
+	maxIdempotencyKeyLength       = 255
+	idempotencySweepInterval      = time.Minute
+)
+
+// IdempotencyRecord a request seen by the idempotency middleware. Status is zero while the first request is in
+// flight.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore keeps the responses of the requests with an idempotency key. The lock token identifies the
+// request holding an in-flight key, so a request whose lock timed out cannot overwrite the retry that took over.
+type IdempotencyStore interface {
+	// Begin records the key as in flight with the lock token until the lock timeout. If the key is already recorded
+	// and not expired, it returns the existing record and false instead.
+	Begin(ctx context.Context, key, fingerprint, lockToken string, lockTimeout time.Duration) (*IdempotencyRecord,
+		bool, error)
+	// Complete stores the response of the key in flight with the lock token, kept until the TTL. It returns an error
+	// if the key is no longer in flight with the lock token.
+	Complete(ctx context.Context, key, lockToken string, status int, header http.Header, body []byte,
+		ttl time.Duration) error
+	// Release forgets the key in flight with the lock token so the request can be retried.
+	Release(ctx context.Context, key, lockToken string) error
+}
+
+// IdempotencyOptions the options of the idempotency middleware.
+type IdempotencyOptions struct {
+	// Store keeps the responses. It is required.
+	Store IdempotencyStore
+	// TTL how long the responses are replayed. Zero means 24 hours.
+	TTL time.Duration
+	// LockTimeout how long a request stays in flight before a retry can take over, in case the instance handling it
+	// died. Zero means a minute.
+	LockTimeout time.Duration
+	// Methods the methods honoring the key. Empty means POST and PATCH.
+	Methods []string
+	// Required rejects the requests without a key with a 400.
+	Required bool
+	// MaxBodyBytes the greatest request body fingerprinted. Zero means 1 MiB.
+	MaxBodyBytes int64
+	// MaxResponseBytes the greatest response body stored for replay. Larger responses release the key, like server
+	// errors. Zero means 1 MiB.
+	MaxResponseBytes int64
+}
+
+// idempotency the idempotency middleware, used as the Class tag of the log lines.
+type idempotency struct {
+	opts    IdempotencyOptions
+	methods map[string]bool
+}
+
+// Idempotency returns a middleware making requests with an Idempotency-Key header safe to retry. The first response
+// of every key, its status, headers and body, is stored and replayed to the repeated requests with an
+// Idempotent-Replayed header. Repeats arriving while the first request is in flight get a 409 and repeats with a
+// different payload a 422. Server errors, panics and responses too large to store release the key so the request can
+// be retried.
+// Keys are scoped to the authenticated subject, so it must run after the authentication middleware.
+// It panics if the store is nil.
+func Idempotency(opts IdempotencyOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		panic("web: idempotency store cannot be nil")
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = defaultIdempotencyTTL
+	}
+
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = defaultIdempotencyLockTimeout
+	}
+
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultIdempotencyMaxBody
+	}
+
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = defaultIdempotencyMaxResponse
+	}
+
+	theIdempotency := &idempotency{opts: opts, methods: make(map[string]bool, len(opts.Methods))}
+	for _, method := range opts.Methods {
+		theIdempotency.methods[method] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			theIdempotency.serve(next, w, r)
+		})
+	}
+}
+
+func (theIdempotency *idempotency) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if !theIdempotency.methods[r.Method] {
+		next.ServeHTTP(w, r)
+
+		return
+	}
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+
+	switch {
+	case key == "" && !theIdempotency.opts.Required:
+		next.ServeHTTP(w, r)
+
+		return
+	case key == "":
+		_ = EncodeError(w, &RequestError{Status: http.StatusBadRequest, Message: "Idempotency-Key header is required"})
+
+		return
+	case len(key) > maxIdempotencyKeyLength:
+		_ = EncodeError(w, &RequestError{
+			Status:  http.StatusBadRequest,
+			Message: "Idempotency-Key header cannot be longer than " + strconv.Itoa(maxIdempotencyKeyLength),
+		})
+
+		return
+	}
+
+	fingerprint, err := theIdempotency.fingerprint(r)
+	if err != nil {
+		_ = EncodeError(w, err)
+
+		return
+	}
+
+	if subject := SubjectFromContext(r.Context()); subject != "" {
+		key = subject + "|" + key
+	}
+
+	ctx := r.Context()
+	logger := log.FromContext(ctx)
+
+	lockToken, err := newLockToken()
+	if err != nil {
+		logger.Error(theIdempotency, nil, err, "Error generating idempotency lock token")
+		_ = EncodeError(w, &RequestError{
+			Status:  http.StatusServiceUnavailable,
+			Message: "idempotency store unavailable",
+		})
+
+		return
+	}
+
+	record, acquired, err := theIdempotency.opts.Store.Begin(ctx, key, fingerprint, lockToken,
+		theIdempotency.opts.LockTimeout)
+	if err != nil {
+		// Fail closed: running the request without the guarantee could duplicate it.
+		logger.Error(theIdempotency, nil, err, "Error beginning idempotent request")
+		_ = EncodeError(w, &RequestError{
+			Status:  http.StatusServiceUnavailable,
+			Message: "idempotency store unavailable",
+		})
+
+		return
+	}
+
+	if !acquired {
+		theIdempotency.repeat(w, record, fingerprint)
+
+		return
+	}
+
+	completed := false
+
+	defer func() {
+		if !completed {
+			// The handler panicked, let the client retry.
+			if err := theIdempotency.opts.Store.Release(context.WithoutCancel(ctx), key, lockToken); err != nil {
+				logger.Error(theIdempotency, nil, err, "Error releasing idempotency key")
+			}
+		}
+	}()
+
+	body := &cappedBuffer{limit: theIdempotency.opts.MaxResponseBytes}
+	wrapped := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	wrapped.Tee(body)
+
+	next.ServeHTTP(wrapped, r)
+
+	completed = true
+
+	status := wrapped.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	// The request may be done, the outcome must be stored anyway.
+	storeCtx := context.WithoutCancel(ctx)
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		err = theIdempotency.opts.Store.Release(storeCtx, key, lockToken)
+	case body.truncated:
+		logger.Warn(theIdempotency, nil, "Response is too large to be replayed, releasing idempotency key")
+		err = theIdempotency.opts.Store.Release(storeCtx, key, lockToken)
+	default:
+		err = theIdempotency.opts.Store.Complete(storeCtx, key, lockToken, status, w.Header().Clone(),
+			body.buffer.Bytes(), theIdempotency.opts.TTL)
+	}
+
+	if err != nil {
+		logger.Error(theIdempotency, nil, err, "Error storing idempotent response")
+	}
+}
+
+// fingerprint hashes the method, path, query and body of the request, restoring the body for the handler.
+func (theIdempotency *idempotency) fingerprint(r *http.Request) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, theIdempotency.opts.MaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return "", &RequestError{Status: http.StatusRequestEntityTooLarge, Message: "request body is too large"}
+		}
+
+		return "", &RequestError{Status: http.StatusBadRequest, Message: "request body cannot be read"}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newLockToken generates a random token identifying the request holding an idempotency key.
+func newLockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// cappedBuffer keeps the response body up to the limit, never failing the writes to the client.
+type cappedBuffer struct {
+	buffer    bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (capped *cappedBuffer) Write(p []byte) (int, error) {
+	if capped.truncated {
+		return len(p), nil
+	}
+
+	if int64(capped.buffer.Len()+len(p)) > capped.limit {
+		capped.truncated = true
+		capped.buffer.Reset()
+
+		return len(p), nil
+	}
+
+	return capped.buffer.Write(p)
+}
+
+func (theIdempotency *idempotency) repeat(w http.ResponseWriter, record *IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		_ = EncodeError(w, &RequestError{
+			Status:  http.StatusUnprocessableEntity,
+			Message: "Idempotency-Key was already used with a different request",
+		})
+
+		return
+	}
+
+	if record.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		_ = EncodeError(w, &RequestError{
+			Status:  http.StatusConflict,
+			Message: "a request with the same Idempotency-Key is in progress",
+		})
+
+		return
+	}
+
+	// Headers already set by the outer middlewares, such as the request ID, describe this request and are kept.
+	header := w.Header()
+	for name, values := range record.Header {
+		if _, ok := header[name]; !ok {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+
+	header.Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// memoryIdempotencyStore an in-memory IdempotencyStore. Expired records are dropped periodically.
+type memoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	records   map[string]*memoryIdempotencyRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryIdempotencyRecord a record of the memory store with the token of the request holding it.
+type memoryIdempotencyRecord struct {
+	IdempotencyRecord
+	lockToken string
+}
+
+// NewMemoryIdempotencyStore creates an in-memory idempotency store. Records are local to the process, so it only
+// protects services running a single replica; use NewMySQLIdempotencyStore otherwise.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{
+		records:   make(map[string]*memoryIdempotencyRecord),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (store *memoryIdempotencyStore) Begin(_ context.Context, key, fingerprint, lockToken string,
+	lockTimeout time.Duration) (*IdempotencyRecord, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := store.now()
+
+	if now.Sub(store.lastSweep) >= idempotencySweepInterval {
+		store.sweep(now)
+	}
+
+	if record, ok := store.records[key]; ok && now.Before(record.ExpiresAt) {
+		copied := record.IdempotencyRecord
+
+		return &copied, false, nil
+	}
+
+	store.records[key] = &memoryIdempotencyRecord{
+		IdempotencyRecord: IdempotencyRecord{Key: key, Fingerprint: fingerprint, ExpiresAt: now.Add(lockTimeout)},
+		lockToken:         lockToken,
+	}
+
+	return nil, true, nil
+}
+
+func (store *memoryIdempotencyStore) Complete(_ context.Context, key, lockToken string, status int,
+	header http.Header, body []byte, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	record, ok := store.records[key]
+	if !ok || record.Status != 0 || record.lockToken != lockToken {
+		return errors.New("idempotency key " + key + " is not in flight with the lock token")
+	}
+
+	record.Status = status
+	record.Header = header
+	record.Body = append([]byte(nil), body...)
+	record.ExpiresAt = store.now().Add(ttl)
+
+	return nil
+}
+
+func (store *memoryIdempotencyStore) Release(_ context.Context, key, lockToken string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if record, ok := store.records[key]; ok && record.Status == 0 && record.lockToken == lockToken {
+		delete(store.records, key)
+	}
+
+	return nil
+}
+
+// sweep drops the expired records. The mutex must be held.
+func (store *memoryIdempotencyStore) sweep(now time.Time) {
+	store.lastSweep = now
+
+	for key, record := range store.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(store.records, key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/adminvoras/commons-lib/pkg/database"
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+)
+
+const (
+	mysqlDuplicateEntry = 1062
+
+	insertIdempotencyQuery = "INSERT INTO %s (idempotency_key, fingerprint, lock_token, status, expires_at, " +
+		"created_at) VALUES (?, ?, ?, 0, ?, ?)"
+	selectIdempotencyQuery = "SELECT idempotency_key, fingerprint, status, headers, body, expires_at FROM %s " +
+		"WHERE idempotency_key = ?"
+	deleteExpiredIdempotencyQuery = "DELETE FROM %s WHERE idempotency_key = ? AND expires_at <= ?"
+	completeIdempotencyQuery      = "UPDATE %s SET status = ?, headers = ?, body = ?, expires_at = ? " +
+		"WHERE idempotency_key = ? AND status = 0 AND lock_token = ?"
+	releaseIdempotencyQuery = "DELETE FROM %s WHERE idempotency_key = ? AND status = 0 AND lock_token = ?"
+)
+
+type idempotencyRow struct {
+	Key         string    `db:"idempotency_key"`
+	Fingerprint string    `db:"fingerprint"`
+	Status      int       `db:"status"`
+	Headers     []byte    `db:"headers"`
+	Body        []byte    `db:"body"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// mysqlIdempotencyStore an IdempotencyStore on a MySQL table.
+type mysqlIdempotencyStore struct {
+	client database.Client
+	table  string
+	now    func() time.Time
+}
+
+// NewMySQLIdempotencyStore creates an idempotency store on the given table, shared by every replica of a service.
+// The table is expected to have the following schema:
+//
+//	CREATE TABLE idempotency_keys (
+//		idempotency_key VARCHAR(512) NOT NULL PRIMARY KEY,
+//		fingerprint     CHAR(64) NOT NULL,
+//		lock_token      CHAR(32) NOT NULL,
+//		status          INT NOT NULL,
+//		headers         TEXT NULL,
+//		body            MEDIUMBLOB NULL,
+//		expires_at      DATETIME(6) NOT NULL,
+//		created_at      DATETIME(6) NOT NULL,
+//		KEY idx_idempotency_keys_expires_at (expires_at)
+//	);
+//
+// Expired rows are replaced when their key is reused; delete them periodically with the expires_at index.
+func NewMySQLIdempotencyStore(client database.Client, table string) (IdempotencyStore, error) {
+	if client == nil {
+		return nil, voraserror.New(nil, "idempotency store database client cannot be nil")
+	}
+
+	if !database.IsValidIdentifier(table) {
+		return nil, voraserror.New(nil, fmt.Sprintf("idempotency store table %q is not valid", table))
+	}
+
+	return &mysqlIdempotencyStore{client: client, table: table, now: time.Now}, nil
+}
+
+func (store *mysqlIdempotencyStore) Begin(_ context.Context, key, fingerprint, lockToken string,
+	lockTimeout time.Duration) (*IdempotencyRecord, bool, error) {
+	// The second attempt covers a record expiring or being released between the insert and the select.
+	for attempt := 0; attempt < 2; attempt++ {
+		now := store.now().UTC()
+
+		_, err := store.client.Exec(fmt.Sprintf(insertIdempotencyQuery, store.table), key, fingerprint, lockToken,
+			now.Add(lockTimeout), now)
+		if err == nil {
+			return nil, true, nil
+		}
+
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntry {
+			return nil, false, err
+		}
+
+		row := idempotencyRow{}
+
+		err = store.client.Get(&row, fmt.Sprintf(selectIdempotencyQuery, store.table), key)
+		if err != nil {
+			if database.IsNoRowsError(err) {
+				continue
+			}
+
+			return nil, false, err
+		}
+
+		if !now.Before(row.ExpiresAt) {
+			if _, err := store.client.Exec(fmt.Sprintf(deleteExpiredIdempotencyQuery, store.table), key,
+				now); err != nil {
+				return nil, false, err
+			}
+
+			continue
+		}
+
+		record := &IdempotencyRecord{
+			Key:         row.Key,
+			Fingerprint: row.Fingerprint,
+			Status:      row.Status,
+			Body:        row.Body,
+			ExpiresAt:   row.ExpiresAt,
+		}
+
+		if len(row.Headers) > 0 {
+			if err := json.Unmarshal(row.Headers, &record.Header); err != nil {
+				return nil, false, err
+			}
+		}
+
+		return record, false, nil
+	}
+
+	return nil, false, fmt.Errorf("idempotency key %s is contended", key)
+}
+
+func (store *mysqlIdempotencyStore) Complete(_ context.Context, key, lockToken string, status int,
+	header http.Header, body []byte, ttl time.Duration) error {
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	result, err := store.client.Exec(fmt.Sprintf(completeIdempotencyQuery, store.table), status, headers, body,
+		store.now().UTC().Add(ttl), key, lockToken)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("idempotency key %s is not in flight with the lock token", key)
+	}
+
+	return nil
+}
+
+func (store *mysqlIdempotencyStore) Release(_ context.Context, key, lockToken string) error {
+	_, err := store.client.Exec(fmt.Sprintf(releaseIdempotencyQuery, store.table), key, lockToken)
+
+	return err
+}
@@ -0,0 +1,249 @@
+package web_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	handler := web.Idempotency(web.IdempotencyOptions{Store: web.NewMemoryIdempotencyStore()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			call := calls.Add(1)
+			body, _ := io.ReadAll(r.Body)
+
+			switch string(body) {
+			case `{"amount":"slow"}`:
+				close(started)
+				<-release
+			case `{"amount":"fail"}`:
+				w.WriteHeader(http.StatusBadGateway)
+
+				return
+			}
+
+			w.Header().Set("Location", "/payments/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"id":1,"call":`+strconv.Itoa(int(call))+`}`)
+		}))
+
+	request := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		req.Header.Set(web.IdempotencyKeyHeader, key)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	first := request("key-1", `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, first.Code, "First request should run")
+	assert.Empty(t, first.Header().Get(web.IdempotentReplayedHeader), "First request should not be a replay")
+
+	replayed := request("key-1", `{"amount":10}`)
+	assert.Equal(t, http.StatusCreated, replayed.Code, "Status should be replayed")
+	assert.Equal(t, first.Body.String(), replayed.Body.String(), "Body should be replayed")
+	assert.Equal(t, "/payments/1", replayed.Header().Get("Location"), "Headers should be replayed")
+	assert.Equal(t, "true", replayed.Header().Get(web.IdempotentReplayedHeader), "Replays should be marked")
+	assert.Equal(t, int32(1), calls.Load(), "Handler should run once")
+
+	mismatch := request("key-1", `{"amount":20}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code, "Different payloads should be rejected")
+
+	assert.Equal(t, http.StatusBadGateway, request("key-2", `{"amount":"fail"}`).Code, "Failure should pass through")
+	assert.Equal(t, http.StatusBadGateway, request("key-2", `{"amount":"fail"}`).Code,
+		"Server errors should release the key")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		request("key-3", `{"amount":"slow"}`)
+	}()
+
+	<-started
+
+	inFlight := request("key-3", `{"amount":"slow"}`)
+	assert.Equal(t, http.StatusConflict, inFlight.Code, "Concurrent duplicates should be rejected")
+
+	close(release)
+	<-done
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	handler := web.Idempotency(web.IdempotencyOptions{Store: web.NewMemoryIdempotencyStore(), Required: true})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/payments", nil))
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "Requests without key should be rejected")
+}
+
+// idempotencyClient a database.Client failing the inserts with the given error, returning the given row and
+// affecting the given number of rows.
+type idempotencyClient struct {
+	queries   []string
+	insertErr error
+	row       map[string]interface{}
+	affected  int64
+}
+
+func (client *idempotencyClient) Exec(query string, args ...interface{}) (sql.Result, error) {
+	client.queries = append(client.queries, query)
+
+	if strings.HasPrefix(query, "INSERT") {
+		return nil, client.insertErr
+	}
+
+	return driver.RowsAffected(client.affected), nil
+}
+
+// Get sets the fields of the row struct by name, since its type is not exported.
+func (client *idempotencyClient) Get(dest interface{}, query string, args ...interface{}) error {
+	client.queries = append(client.queries, query)
+
+	row := reflect.ValueOf(dest).Elem()
+	for name, value := range client.row {
+		row.FieldByName(name).Set(reflect.ValueOf(value))
+	}
+
+	return nil
+}
+
+func (client *idempotencyClient) Select(dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+
+func (client *idempotencyClient) Prepare(query string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (client *idempotencyClient) Beginx() (*sqlx.Tx, error) {
+	return nil, nil
+}
+
+func (client *idempotencyClient) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, nil
+}
+
+func TestMySQLIdempotencyStore(t *testing.T) {
+	client := &idempotencyClient{affected: 1}
+	store, err := web.NewMySQLIdempotencyStore(client, "idempotency_keys")
+	assert.Nil(t, err, "Store should be created")
+
+	ctx := context.Background()
+
+	record, acquired, err := store.Begin(ctx, "key-1", "fingerprint", "token-1", time.Minute)
+	assert.Nil(t, err, "Begin should not fail")
+	assert.True(t, acquired, "New keys should be acquired")
+	assert.Nil(t, record, "New keys should have no record")
+
+	assert.Nil(t, store.Complete(ctx, "key-1", "token-1", http.StatusCreated,
+		http.Header{"Location": {"/payments/1"}}, []byte(`{"id":1}`), time.Hour), "Complete should not fail")
+	assert.Equal(t, "UPDATE idempotency_keys SET status = ?, headers = ?, body = ?, expires_at = ? "+
+		"WHERE idempotency_key = ? AND status = 0 AND lock_token = ?", client.queries[1], "Query is not the expected")
+
+	client.affected = 0
+	assert.Error(t, store.Complete(ctx, "key-1", "token-1", http.StatusCreated, nil, nil, time.Hour),
+		"Complete should fail when the lock was taken over")
+
+	client.insertErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	client.row = map[string]interface{}{
+		"Key":         "key-1",
+		"Fingerprint": "fingerprint",
+		"Status":      http.StatusCreated,
+		"Headers":     []byte(`{"Location":["/payments/1"]}`),
+		"Body":        []byte(`{"id":1}`),
+		"ExpiresAt":   time.Now().Add(time.Hour),
+	}
+
+	record, acquired, err = store.Begin(ctx, "key-1", "fingerprint", "token-2", time.Minute)
+	assert.Nil(t, err, "Begin should not fail")
+	assert.False(t, acquired, "Existing keys should not be acquired")
+	assert.Equal(t, http.StatusCreated, record.Status, "Status is not the expected")
+	assert.Equal(t, "/payments/1", record.Header.Get("Location"), "Headers are not the expected")
+	assert.Equal(t, `{"id":1}`, string(record.Body), "Body is not the expected")
+
+	_, err = web.NewMySQLIdempotencyStore(client, "keys; DROP TABLE users")
+	assert.Error(t, err, "Invalid table names should be rejected")
+}
+
+func TestMemoryIdempotencyStore_LockTakenOver(t *testing.T) {
+	store := web.NewMemoryIdempotencyStore()
+	ctx := context.Background()
+
+	_, acquired, err := store.Begin(ctx, "key-1", "fingerprint", "token-1", time.Nanosecond)
+	assert.Nil(t, err, "Begin should not fail")
+	assert.True(t, acquired, "New keys should be acquired")
+
+	time.Sleep(time.Millisecond)
+
+	_, acquired, err = store.Begin(ctx, "key-1", "fingerprint", "token-2", time.Minute)
+	assert.Nil(t, err, "Begin should not fail")
+	assert.True(t, acquired, "Timed out locks should be taken over")
+
+	assert.Error(t, store.Complete(ctx, "key-1", "token-1", http.StatusCreated, nil, []byte("late"), time.Hour),
+		"Complete should fail with the timed out lock token")
+	assert.Nil(t, store.Release(ctx, "key-1", "token-1"), "Release should not fail")
+
+	assert.Nil(t, store.Complete(ctx, "key-1", "token-2", http.StatusCreated, nil, []byte("retry"), time.Hour),
+		"Complete should not fail with the lock token")
+
+	record, acquired, err := store.Begin(ctx, "key-1", "fingerprint", "token-3", time.Minute)
+	assert.Nil(t, err, "Begin should not fail")
+	assert.False(t, acquired, "Completed keys should not be acquired")
+	assert.Equal(t, "retry", string(record.Body), "The response of the retry should be kept")
+}
+
+func TestIdempotency_QueryAndLargeResponses(t *testing.T) {
+	var calls atomic.Int32
+
+	handler := web.Idempotency(web.IdempotencyOptions{Store: web.NewMemoryIdempotencyStore(), MaxResponseBytes: 8})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, r.URL.Query().Get("body"))
+		}))
+
+	request := func(key, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set(web.IdempotencyKeyHeader, key)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusCreated, request("key-1", "/payments?body=small").Code, "First request should run")
+	assert.Equal(t, http.StatusUnprocessableEntity, request("key-1", "/payments?body=other").Code,
+		"Different queries should be rejected")
+
+	large := request("key-2", "/payments?body=too-large-to-store")
+	assert.Equal(t, "too-large-to-store", large.Body.String(), "Large responses should reach the client")
+
+	retried := request("key-2", "/payments?body=too-large-to-store")
+	assert.Empty(t, retried.Header().Get(web.IdempotentReplayedHeader), "Large responses should not be replayed")
+	assert.Equal(t, int32(3), calls.Load(), "Large responses should release the key")
+}
@@ -0,0 +1,351 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultJWKSTTL        = 10 * time.Minute
+	minJWKSRefresh        = 10 * time.Second
+	maxJWKSDocumentBytes  = 1 << 20
+	jwksHTTPClientTimeout = 10 * time.Second
+)
+
+// KeySet provides the keys verifying the JWT signatures.
+type KeySet interface {
+	// Key returns the key identified by kid for the algorithm: []byte for HS256, *rsa.PublicKey for RS256 and
+	// *ecdsa.PublicKey for ES256.
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+type staticKeySet struct {
+	keys map[string]interface{}
+}
+
+// NewStaticKeySet creates a key set from keys indexed by their kid. Tokens without a kid are verified with the only
+// key of the set, if there is exactly one.
+func NewStaticKeySet(keys map[string]interface{}) KeySet {
+	copied := make(map[string]interface{}, len(keys))
+	for kid, key := range keys {
+		copied[kid] = key
+	}
+
+	return &staticKeySet{keys: copied}
+}
+
+func (set *staticKeySet) Key(_ context.Context, kid, _ string) (interface{}, error) {
+	if key, ok := set.keys[kid]; ok {
+		return key, nil
+	}
+
+	if kid == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key %q not found", kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jwksDocument struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jwksKey struct {
+	alg string
+	key interface{}
+}
+
+type jwksKeySet struct {
+	source     string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mutex       sync.Mutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+	fetching    chan struct{}
+}
+
+// NewJWKSKeySet creates a key set loading a JWKS document from a file path or an http(s) URL. The document is cached
+// during the TTL, zero meaning 10 minutes, and reloaded earlier when a token references an unknown kid so key
+// rotations are picked up. Keys of unsupported types are skipped, and the previous keys keep being served while the
+// document cannot be reloaded.
+func NewJWKSKeySet(source string, ttl time.Duration) KeySet {
+	if ttl <= 0 {
+		ttl = defaultJWKSTTL
+	}
+
+	return &jwksKeySet{
+		source:     source,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: jwksHTTPClientTimeout},
+	}
+}
+
+func (set *jwksKeySet) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	set.mutex.Lock()
+	keys := set.keys
+	stale := keys == nil || time.Since(set.fetchedAt) >= set.ttl
+	set.mutex.Unlock()
+
+	if stale {
+		keys = set.refresh(ctx, true)
+	}
+
+	key, ok := lookupJWKSKey(keys, kid)
+	if !ok && !stale {
+		keys = set.refresh(ctx, false)
+		key, ok = lookupJWKSKey(keys, kid)
+	}
+
+	if keys == nil {
+		set.mutex.Lock()
+		err := set.lastErr
+		set.mutex.Unlock()
+
+		if err == nil {
+			err = fmt.Errorf("JWKS from %s is not loaded yet", set.source)
+		}
+
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", kid)
+	}
+
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("key %q is not meant for %s", kid, alg)
+	}
+
+	return key.key, nil
+}
+
+func lookupJWKSKey(keys map[string]jwksKey, kid string) (jwksKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+
+	return jwksKey{}, false
+}
+
+// refresh reloads the JWKS document and returns the current keys. Reloads looking for an unknown kid or retrying a
+// failed one happen at most once every minJWKSRefresh, while an expired document is reloaded right away after a
+// successful load. A single fetch runs at a time without holding the mutex, the concurrent callers wait for it. When
+// the fetch fails the previous keys are kept.
+func (set *jwksKeySet) refresh(ctx context.Context, expired bool) map[string]jwksKey {
+	set.mutex.Lock()
+
+	if fetching := set.fetching; fetching != nil {
+		set.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-fetching:
+		}
+
+		set.mutex.Lock()
+		defer set.mutex.Unlock()
+
+		return set.keys
+	}
+
+	throttled := !expired || set.lastErr != nil
+	if throttled && !set.attemptedAt.IsZero() && time.Since(set.attemptedAt) < minJWKSRefresh {
+		defer set.mutex.Unlock()
+
+		return set.keys
+	}
+
+	fetching := make(chan struct{})
+	set.fetching = fetching
+	set.attemptedAt = time.Now()
+	set.mutex.Unlock()
+
+	// The fetch outlives a cancelled request since other callers may be waiting for it.
+	keys, err := set.fetch(context.WithoutCancel(ctx))
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if err != nil {
+		set.lastErr = fmt.Errorf("error loading JWKS from %s: %w", set.source, err)
+		log.FromContext(ctx).Error(set, nil, set.lastErr, "Error refreshing JWKS, keeping the previous keys")
+	} else {
+		set.keys, set.fetchedAt, set.lastErr = keys, time.Now(), nil
+	}
+
+	set.fetching = nil
+	close(fetching)
+
+	return set.keys
+}
+
+// fetch loads the JWKS document and parses its signing keys, skipping the ones whose type is not supported.
+func (set *jwksKeySet) fetch(ctx context.Context) (map[string]jwksKey, error) {
+	document, err := set.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jwksKey, len(document.Keys))
+
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.FromContext(ctx).Warn(set, map[string]string{"kid": jwk.Kid}, "Skipping JWKS key: %v", err)
+
+			continue
+		}
+
+		keys[jwk.Kid] = jwksKey{alg: jwk.Alg, key: key}
+	}
+
+	return keys, nil
+}
+
+func (set *jwksKeySet) load(ctx context.Context) (*jwksDocument, error) {
+	var reader io.Reader
+
+	if strings.HasPrefix(set.source, "http://") || strings.HasPrefix(set.source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, set.source, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := set.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		reader = resp.Body
+	} else {
+		file, err := os.Open(set.source)
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		reader = file
+	}
+
+	document := &jwksDocument{}
+	if err := json.NewDecoder(io.LimitReader(reader, maxJWKSDocumentBytes)).Decode(document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("RSA exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("curve %q is not supported", jwk.Crv)
+		}
+
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x.Bytes()) > 32 || len(y.Bytes()) > 32 {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+
+		// crypto/ecdh rejects points that are not on the curve.
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	default:
+		return nil, fmt.Errorf("key type %q is not supported", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
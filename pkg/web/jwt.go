@@ -0,0 +1,419 @@
+package web
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+
+	bearerPrefix = "bearer "
+)
+
+type claimsContextKey struct{}
+
+// Audience the aud claim, which may be a single string or an array of strings.
+type Audience []string
+
+func (audience *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*audience = Audience{single}
+
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+
+	*audience = multiple
+
+	return nil
+}
+
+// Claims the registered claims of a JWT plus the scope and roles claims used for authorization.
+// The exp, nbf and iat NumericDate claims are truncated to seconds. Raw holds every claim so services can read their
+// custom ones.
+type Claims struct {
+	Issuer    string                 `json:"iss"`
+	Subject   string                 `json:"sub"`
+	Audience  Audience               `json:"aud"`
+	ExpiresAt int64                  `json:"exp"`
+	NotBefore int64                  `json:"nbf"`
+	IssuedAt  int64                  `json:"iat"`
+	ID        string                 `json:"jti"`
+	Scope     string                 `json:"scope"`
+	Roles     []string               `json:"roles"`
+	Raw       map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the claims, accepting NumericDate claims with a fractional part.
+func (claims *Claims) UnmarshalJSON(data []byte) error {
+	type plainClaims Claims
+
+	decoded := struct {
+		*plainClaims
+		ExpiresAt json.Number `json:"exp"`
+		NotBefore json.Number `json:"nbf"`
+		IssuedAt  json.Number `json:"iat"`
+	}{plainClaims: (*plainClaims)(claims)}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var err error
+
+	if claims.ExpiresAt, err = numericDate(decoded.ExpiresAt); err != nil {
+		return err
+	}
+
+	if claims.NotBefore, err = numericDate(decoded.NotBefore); err != nil {
+		return err
+	}
+
+	claims.IssuedAt, err = numericDate(decoded.IssuedAt)
+
+	return err
+}
+
+// numericDate returns the seconds of the NumericDate, zero if it is missing.
+func numericDate(number json.Number) (int64, error) {
+	if number == "" {
+		return 0, nil
+	}
+
+	if seconds, err := number.Int64(); err == nil {
+		return seconds, nil
+	}
+
+	seconds, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return 0, fmt.Errorf("numeric date %s is not valid", number)
+	}
+
+	if seconds >= math.MaxInt64 || seconds <= math.MinInt64 {
+		return 0, fmt.Errorf("numeric date %s is out of range", number)
+	}
+
+	return int64(seconds), nil
+}
+
+// Scopes returns the space separated scopes of the scope claim.
+func (claims *Claims) Scopes() []string {
+	return strings.Fields(claims.Scope)
+}
+
+// HasScope returns true if the token was granted the scope.
+func (claims *Claims) HasScope(scope string) bool {
+	for _, granted := range claims.Scopes() {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasRole returns true if the token carries the role.
+func (claims *Claims) HasRole(role string) bool {
+	for _, granted := range claims.Roles {
+		if granted == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JWTOptions the options used to validate JWTs.
+type JWTOptions struct {
+	// KeySet provides the verification keys.
+	KeySet KeySet
+	// Algorithms the accepted signing algorithms. Empty means HS256, RS256 and ES256.
+	Algorithms []string
+	// Issuer the expected iss claim. Empty skips the check.
+	Issuer string
+	// Audience the audience that must be present in the aud claim. Empty skips the check.
+	Audience string
+	// Leeway the clock skew tolerated checking exp and nbf.
+	Leeway time.Duration
+	// AllowMissingExp accepts tokens without an exp claim, which never expire. They are rejected by default.
+	AllowMissingExp bool
+}
+
+// jwtAuth the JWT authentication middleware, used as the Class tag of the log lines.
+type jwtAuth struct{}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// ClaimsFromContext returns the claims stored by the JWTAuth middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+
+	return claims, ok
+}
+
+// JWTAuth returns a middleware validating the bearer token of the Authorization header. The claims of valid tokens
+// are stored in the request context, available with ClaimsFromContext, and the subject is recorded both as the
+// request subject and as the actor of log.WithActor. Missing or invalid tokens get a JSON 401 whose detail is only
+// logged, since it may describe the key set. It panics if the key set is nil.
+func JWTAuth(opts JWTOptions) func(http.Handler) http.Handler {
+	if opts.KeySet == nil {
+		panic("web: JWT key set cannot be nil")
+	}
+
+	auth := &jwtAuth{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if len(authorization) <= len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)],
+				bearerPrefix) {
+				unauthorized(w, "bearer token is required")
+
+				return
+			}
+
+			claims, err := ParseJWT(r.Context(), strings.TrimSpace(authorization[len(bearerPrefix):]), opts)
+			if err != nil {
+				log.FromContext(r.Context()).Info(auth, nil, "Rejected bearer token: %s", err)
+				unauthorized(w, "token is not valid")
+
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+			ctx = WithSubject(ctx, claims.Subject)
+			ctx = log.WithActor(ctx, claims.Subject)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScopes returns a middleware rejecting with a JSON 403 the requests whose token lacks any of the scopes.
+// It must run after JWTAuth.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(claims *Claims) bool {
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				return false
+			}
+		}
+
+		return true
+	}, "token lacks the required scopes "+strings.Join(scopes, ", "))
+}
+
+// RequireRoles returns a middleware rejecting with a JSON 403 the requests whose token carries none of the roles.
+// It must run after JWTAuth.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(claims *Claims) bool {
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				return true
+			}
+		}
+
+		return false
+	}, "token lacks one of the roles "+strings.Join(roles, ", "))
+}
+
+func requireClaims(allowed func(claims *Claims) bool, message string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				unauthorized(w, "bearer token is required")
+
+				return
+			}
+
+			if !allowed(claims) {
+				_ = EncodeError(w, &RequestError{Status: http.StatusForbidden, Message: message})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+	_ = EncodeError(w, &RequestError{Status: http.StatusUnauthorized, Message: message})
+}
+
+// ParseJWT verifies the signature of the compact serialized token and validates its exp, nbf, iss and aud claims.
+// Tokens without exp are rejected unless the options allow them.
+func ParseJWT(ctx context.Context, token string, opts JWTOptions) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is malformed")
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("token header is malformed")
+	}
+
+	if !algorithmAllowed(header.Alg, opts.Algorithms) {
+		return nil, fmt.Errorf("token algorithm %q is not allowed", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature is malformed")
+	}
+
+	key, err := opts.KeySet.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, fmt.Errorf("token key is not valid: %w", err)
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("token claims are malformed")
+	}
+
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return nil, fmt.Errorf("token claims are malformed")
+	}
+
+	if err := validateClaims(claims, opts, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, dst interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, dst)
+}
+
+func algorithmAllowed(alg string, allowed []string) bool {
+	if len(allowed) == 0 {
+		allowed = []string{AlgorithmHS256, AlgorithmRS256, AlgorithmES256}
+	}
+
+	for _, candidate := range allowed {
+		if alg == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifySignature checks the signature with a key whose type must match the algorithm, so a public key can never be
+// used as an HMAC secret.
+func verifySignature(alg string, key interface{}, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	invalid := fmt.Errorf("token signature is not valid")
+
+	switch alg {
+	case AlgorithmHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("token key is not valid for %s", alg)
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid
+		}
+	case AlgorithmRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("token key is not valid for %s", alg)
+		}
+
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return invalid
+		}
+	case AlgorithmES256:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return invalid
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("token algorithm %q is not supported", alg)
+	}
+
+	return nil
+}
+
+func validateClaims(claims *Claims, opts JWTOptions, now time.Time) error {
+	if claims.ExpiresAt == 0 {
+		if !opts.AllowMissingExp {
+			return fmt.Errorf("token has no expiration")
+		}
+	} else if now.After(time.Unix(claims.ExpiresAt, 0).Add(opts.Leeway)) {
+		return fmt.Errorf("token is expired")
+	}
+
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-opts.Leeway)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return fmt.Errorf("token issuer is not valid")
+	}
+
+	if opts.Audience != "" {
+		for _, audience := range claims.Audience {
+			if audience == opts.Audience {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("token audience is not valid")
+	}
+
+	return nil
+}
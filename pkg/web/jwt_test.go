@@ -0,0 +1,366 @@
+package web_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+var jwtSecret = []byte("top-secret")
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	encoded, err := json.Marshal(v)
+	assert.Nil(t, err, "Error encoding JWT segment")
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func signHS256(t *testing.T, kid string, claims map[string]interface{}) string {
+	input := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid}) + "." +
+		encodeSegment(t, claims)
+
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(input))
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseJWT(t *testing.T) {
+	now := time.Now().Unix()
+	opts := web.JWTOptions{
+		KeySet:   web.NewStaticKeySet(map[string]interface{}{"hmac": jwtSecret}),
+		Issuer:   "https://auth.voras.com",
+		Audience: "orders",
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    "https://auth.voras.com",
+			"sub":    "user-1",
+			"aud":    []string{"orders", "payments"},
+			"exp":    now + 60,
+			"scope":  "orders:read orders:write",
+			"tenant": "acme",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{
+			name:  "Valid token",
+			token: func() string { return signHS256(t, "hmac", validClaims()) },
+		},
+		{
+			name: "Expired token",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = now - 60
+
+				return signHS256(t, "hmac", claims)
+			},
+			wantErr: "token is expired",
+		},
+		{
+			name: "Token not valid yet",
+			token: func() string {
+				claims := validClaims()
+				claims["nbf"] = now + 60
+
+				return signHS256(t, "hmac", claims)
+			},
+			wantErr: "token is not valid yet",
+		},
+		{
+			name: "Wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "billing"
+
+				return signHS256(t, "hmac", claims)
+			},
+			wantErr: "token audience is not valid",
+		},
+		{
+			name: "Wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://evil.com"
+
+				return signHS256(t, "hmac", claims)
+			},
+			wantErr: "token issuer is not valid",
+		},
+		{
+			name: "Fractional numeric dates",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = float64(now) + 60.5
+				claims["iat"] = float64(now) - 0.25
+
+				return signHS256(t, "hmac", claims)
+			},
+		},
+		{
+			name: "Numeric date out of range",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = 1e300
+
+				return signHS256(t, "hmac", claims)
+			},
+			wantErr: "token claims are malformed",
+		},
+		{
+			name:    "Tampered signature",
+			token:   func() string { return signHS256(t, "hmac", validClaims()) + "x" },
+			wantErr: "token signature",
+		},
+		{
+			name: "Algorithm none",
+			token: func() string {
+				return encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, validClaims()) + "."
+			},
+			wantErr: `token algorithm "none" is not allowed`,
+		},
+		{
+			name:    "Unknown key",
+			token:   func() string { return signHS256(t, "other", validClaims()) },
+			wantErr: `key "other" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := web.ParseJWT(context.Background(), tt.token(), opts)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr, "Error is not the expected")
+
+				return
+			}
+
+			assert.Nil(t, err, "Token should be valid")
+			assert.Equal(t, "user-1", claims.Subject, "Subject is not the expected")
+			assert.True(t, claims.HasScope("orders:write"), "Scope should be granted")
+			assert.Equal(t, "acme", claims.Raw["tenant"], "Custom claim is not the expected")
+		})
+	}
+}
+
+func TestParseJWT_MissingExp(t *testing.T) {
+	token := signHS256(t, "hmac", map[string]interface{}{"sub": "user-1"})
+	keySet := web.NewStaticKeySet(map[string]interface{}{"hmac": jwtSecret})
+
+	_, err := web.ParseJWT(context.Background(), token, web.JWTOptions{KeySet: keySet})
+	assert.EqualError(t, err, "token has no expiration", "Token without exp should be rejected")
+
+	claims, err := web.ParseJWT(context.Background(), token, web.JWTOptions{KeySet: keySet, AllowMissingExp: true})
+	assert.Nil(t, err, "Token without exp should be accepted when allowed")
+	assert.Equal(t, "user-1", claims.Subject, "Subject is not the expected")
+}
+
+func TestParseJWTWithJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, "Error generating RSA key")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "Error generating EC key")
+
+	document := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa", "alg": "RS256", "use": "sig",
+				"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	encoded, err := json.Marshal(document)
+	assert.Nil(t, err, "Error encoding JWKS")
+	assert.Nil(t, os.WriteFile(path, encoded, 0o600), "Error writing JWKS")
+
+	opts := web.JWTOptions{KeySet: web.NewJWKSKeySet(path, 0)}
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Unix() + 60}
+
+	rsaInput := encodeSegment(t, map[string]string{"alg": "RS256", "kid": "rsa"}) + "." + encodeSegment(t, claims)
+	rsaDigest := sha256.Sum256([]byte(rsaInput))
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, rsaDigest[:])
+	assert.Nil(t, err, "Error signing RS256 token")
+
+	ecInput := encodeSegment(t, map[string]string{"alg": "ES256", "kid": "ec"}) + "." + encodeSegment(t, claims)
+	ecDigest := sha256.Sum256([]byte(ecInput))
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, ecDigest[:])
+	assert.Nil(t, err, "Error signing ES256 token")
+
+	ecSignature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	tokens := map[string]string{
+		"RS256": rsaInput + "." + base64.RawURLEncoding.EncodeToString(rsaSignature),
+		"ES256": ecInput + "." + base64.RawURLEncoding.EncodeToString(ecSignature),
+	}
+
+	for alg, token := range tokens {
+		parsed, err := web.ParseJWT(context.Background(), token, opts)
+		assert.Nil(t, err, fmt.Sprintf("%s token should be valid", alg))
+		assert.Equal(t, "user-1", parsed.Subject, "Subject is not the expected")
+	}
+
+	hmacWithPublicKey := signHS256(t, "rsa", claims)
+	_, err = web.ParseJWT(context.Background(), hmacWithPublicKey, opts)
+	assert.Error(t, err, "RSA keys must not verify HS256 tokens")
+}
+
+func TestJWTAuth(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(web.JWTAuth(web.JWTOptions{KeySet: web.NewStaticKeySet(map[string]interface{}{"hmac": jwtSecret})}))
+	router.With(web.RequireScopes("orders:read")).Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := web.ClaimsFromContext(r.Context())
+		actor := log.ActorFromContext(r.Context())
+
+		_, _ = fmt.Fprintf(w, "%s %s %s", claims.Subject, web.SubjectFromContext(r.Context()), actor)
+	})
+	router.With(web.RequireRoles("admin")).Delete("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	token := signHS256(t, "hmac", map[string]interface{}{
+		"sub":   "user-1",
+		"exp":   time.Now().Unix() + 60,
+		"scope": "orders:read",
+		"roles": []string{"viewer"},
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:       "Missing token",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"status":401,"message":"bearer token is required"}`,
+		},
+		{
+			name:          "Invalid token",
+			method:        http.MethodGet,
+			authorization: "Bearer invalid",
+			wantStatus:    http.StatusUnauthorized,
+			wantBody:      `{"status":401,"message":"token is not valid"}`,
+		},
+		{
+			name:          "Granted scope",
+			method:        http.MethodGet,
+			authorization: "Bearer " + token,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Missing role",
+			method:        http.MethodDelete,
+			authorization: "Bearer " + token,
+			wantStatus:    http.StatusForbidden,
+			wantBody:      `{"status":403,"message":"token lacks one of the roles admin"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+			} else {
+				assert.Equal(t, "user-1 user-1 user-1", recorder.Body.String(), "Claims are not in the context")
+			}
+		})
+	}
+}
+
+func TestJWKSKeySet_Refresh(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, "Error generating RSA key")
+
+	document := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "OKP", "kid": "ed25519", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"},
+			{
+				"kty": "RSA", "kid": "rsa", "alg": "RS256",
+				"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+		},
+	}
+
+	var fetches int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The identity provider goes down after serving the document once.
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		_ = web.EncodeJSON(w, document, http.StatusOK)
+	}))
+	defer server.Close()
+
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "kid": "rsa"}) + "." +
+		encodeSegment(t, map[string]interface{}{"sub": "user-1", "exp": time.Now().Unix() + 60})
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	assert.Nil(t, err, "Error signing RS256 token")
+
+	token := input + "." + base64.RawURLEncoding.EncodeToString(signature)
+	opts := web.JWTOptions{KeySet: web.NewJWKSKeySet(server.URL, time.Nanosecond)}
+
+	for i := 0; i < 3; i++ {
+		_, err = web.ParseJWT(context.Background(), token, opts)
+		assert.Nil(t, err, "Token should be verified with the previous keys while the refresh fails")
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches), "Failed refresh should not be retried right away")
+}
@@ -0,0 +1,391 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const openAPIVersion = "3.1.0"
+
+var (
+	patternRegexpParam = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+	patternParam       = regexp.MustCompile(`\{([^}]+)\}`)
+	errorResponseType  = reflect.TypeOf(ErrorResponse{})
+)
+
+// Operation the documentation of a route.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	OperationID string
+	Deprecated  bool
+	// Request a value of the request struct: fields tagged with param or query are documented as parameters and
+	// the other JSON fields as the body, as BindParams and DecodeJSON read them. Nil means no parameters nor body.
+	Request interface{}
+	// Response a value of the response body. Nil means no body.
+	Response interface{}
+	// Status the status of successful responses. Zero means 200, or 204 without a response body.
+	Status int
+	// Errors the error statuses the route answers with an ErrorResponse. 400 is always documented for routes
+	// with a request struct.
+	Errors []int
+}
+
+// documentedHandler a handler carrying its documentation.
+type documentedHandler struct {
+	http.Handler
+	operation Operation
+}
+
+// Document attaches the documentation to the handler, to be registered on a chi router with Method or Handle:
+//
+//	router.Method(http.MethodPost, "/orders", web.Document(web.Operation{
+//		Summary:  "Create an order",
+//		Request:  createOrderRequest{},
+//		Response: order{},
+//		Status:   http.StatusCreated,
+//		Errors:   []int{http.StatusConflict},
+//	}, createOrderHandler))
+func Document(operation Operation, handler http.Handler) http.Handler {
+	return &documentedHandler{Handler: handler, operation: operation}
+}
+
+// OpenAPIInfo the info object of the OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIDocument an OpenAPI 3.1 document.
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components,omitempty"`
+}
+
+// OpenAPIPathItem the operations of a path, indexed by lower case method.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIComponents the reusable schemas of the document.
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// OpenAPIOperation an operation of the document.
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	OperationID string                     `json:"operationId,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter a path or query parameter.
+type OpenAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody a request body.
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse a response.
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType the schema of a body.
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// GenerateOpenAPI walks the routes of the router and documents them. Routes registered with Document get their
+// parameters, bodies, responses and schemas, the others only their path parameters.
+func GenerateOpenAPI(routes chi.Routes, info OpenAPIInfo) (*OpenAPIDocument, error) {
+	registry := newSchemaRegistry()
+	document := &OpenAPIDocument{OpenAPI: openAPIVersion, Info: info, Paths: map[string]OpenAPIPathItem{}}
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler,
+		_ ...func(http.Handler) http.Handler) error {
+		path, pathParams := openAPIPath(route)
+
+		pathItem, ok := document.Paths[path]
+		if !ok {
+			pathItem = OpenAPIPathItem{}
+			document.Paths[path] = pathItem
+		}
+
+		operation := &OpenAPIOperation{Responses: map[string]OpenAPIResponse{}}
+
+		documented, ok := unwrapHandler(handler).(*documentedHandler)
+		if ok {
+			documentOperation(registry, operation, documented.operation)
+		} else {
+			operation.Responses["default"] = OpenAPIResponse{Description: "Undocumented response"}
+		}
+
+		addPathParams(operation, pathParams)
+		pathItem[strings.ToLower(method)] = operation
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	document.Components.Schemas = registry.schemas
+
+	return document, nil
+}
+
+// OpenAPIHandler returns a handler serving the OpenAPI document of the router as JSON. The document is generated on
+// the first request, once every route is registered.
+func OpenAPIHandler(routes chi.Routes, info OpenAPIInfo) http.Handler {
+	var (
+		once     sync.Once
+		document []byte
+		err      error
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			var generated *OpenAPIDocument
+
+			if generated, err = GenerateOpenAPI(routes, info); err == nil {
+				document, err = json.Marshal(generated)
+			}
+		})
+
+		if err != nil {
+			_ = EncodeError(w, err)
+
+			return
+		}
+
+		_ = EncodeJSON(w, document, http.StatusOK)
+	})
+}
+
+// unwrapHandler returns the endpoint of handlers wrapped by inline middlewares.
+func unwrapHandler(handler http.Handler) http.Handler {
+	for {
+		chain, ok := handler.(*chi.ChainHandler)
+		if !ok {
+			return handler
+		}
+
+		handler = chain.Endpoint
+	}
+}
+
+// openAPIPath converts a chi route pattern to an OpenAPI path, returning its parameter names.
+func openAPIPath(route string) (string, []string) {
+	path := patternRegexpParam.ReplaceAllString(route, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	var params []string
+	for _, match := range patternParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, match[1])
+	}
+
+	return path, params
+}
+
+func documentOperation(registry *schemaRegistry, operation *OpenAPIOperation, documented Operation) {
+	operation.Summary = documented.Summary
+	operation.Description = documented.Description
+	operation.Tags = documented.Tags
+	operation.OperationID = documented.OperationID
+	operation.Deprecated = documented.Deprecated
+
+	errorStatuses := append([]int(nil), documented.Errors...)
+
+	if documented.Request != nil {
+		requestType := reflect.TypeOf(documented.Request)
+		for requestType.Kind() == reflect.Pointer {
+			requestType = requestType.Elem()
+		}
+
+		if requestType.Kind() == reflect.Struct {
+			operation.Parameters = requestParams(registry, requestType)
+		}
+
+		if hasBody(requestType) {
+			operation.RequestBody = &OpenAPIRequestBody{
+				Required: true,
+				Content:  jsonContent(registry.schemaFor(requestType)),
+			}
+		}
+
+		errorStatuses = append(errorStatuses, http.StatusBadRequest)
+	}
+
+	status := documented.Status
+	if status == 0 {
+		status = http.StatusOK
+		if documented.Response == nil {
+			status = http.StatusNoContent
+		}
+	}
+
+	success := OpenAPIResponse{Description: http.StatusText(status)}
+	if documented.Response != nil {
+		success.Content = jsonContent(registry.schemaFor(reflect.TypeOf(documented.Response)))
+	}
+
+	operation.Responses[strconv.Itoa(status)] = success
+
+	sort.Ints(errorStatuses)
+
+	for _, errorStatus := range errorStatuses {
+		operation.Responses[strconv.Itoa(errorStatus)] = OpenAPIResponse{
+			Description: http.StatusText(errorStatus),
+			Content:     jsonContent(registry.schemaFor(errorResponseType)),
+		}
+	}
+}
+
+// requestParams documents the fields of the request struct bound from the URL and the query string.
+func requestParams(registry *schemaRegistry, structType reflect.Type) []OpenAPIParameter {
+	var params []OpenAPIParameter
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			params = append(params, requestParams(registry, field.Type)...)
+
+			continue
+		}
+
+		source, tag := fieldParamSource(field)
+		if source == "" {
+			continue
+		}
+
+		name, flags, _ := strings.Cut(tag, ",")
+		schema := registry.schemaFor(field.Type)
+		required := applyRules(schema, field) || strings.Contains(flags, requiredFlag)
+
+		if def, ok := field.Tag.Lookup(defaultTag); ok {
+			schema.Default = typedDefault(schema, def)
+			required = false
+		}
+
+		param := OpenAPIParameter{Name: name, In: "query", Required: required, Schema: schema}
+		if source == URLParamSource {
+			param.In = "path"
+			param.Required = true
+		}
+
+		params = append(params, param)
+	}
+
+	return params
+}
+
+// hasBody returns true if the request struct has JSON fields, the ones not bound from the URL or the query string.
+func hasBody(requestType reflect.Type) bool {
+	if requestType.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < requestType.NumField(); i++ {
+		field := requestType.Field(i)
+		if !field.IsExported() || fieldName(field) == "-" {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if hasBody(field.Type) {
+				return true
+			}
+
+			continue
+		}
+
+		if source, _ := fieldParamSource(field); source == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addPathParams documents the path parameters of the route missing from the request struct as strings.
+func addPathParams(operation *OpenAPIOperation, names []string) {
+	for _, name := range names {
+		found := false
+
+		for _, param := range operation.Parameters {
+			if param.In == "path" && param.Name == name {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+}
+
+// typedDefault converts the default tag to the type of the schema.
+func typedDefault(schema *Schema, def string) interface{} {
+	var (
+		typed interface{}
+		err   error
+	)
+
+	switch schema.Type {
+	case "boolean":
+		typed, err = strconv.ParseBool(def)
+	case "integer":
+		typed, err = strconv.ParseInt(def, 10, 64)
+	case "number":
+		typed, err = strconv.ParseFloat(def, 64)
+	default:
+		return def
+	}
+
+	if err != nil {
+		return def
+	}
+
+	return typed
+}
+
+func jsonContent(schema *Schema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{"application/json": {Schema: schema}}
+}
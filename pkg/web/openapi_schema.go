@@ -0,0 +1,329 @@
+package web
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/adminvoras/commons-lib/pkg/date"
+)
+
+const (
+	schemaRefPrefix = "#/components/schemas/"
+	// numTZDatePattern matches the date.NumTZLayout values, whose offset has no colon, so they are not date-time.
+	numTZDatePattern = `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?[+-]\d{4}$`
+)
+
+var (
+	uuidType       = reflect.TypeOf(uuid.UUID{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	schemaNameChar = regexp.MustCompile(`[^A-Za-z0-9_.]+`)
+)
+
+// Schema a JSON Schema, as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	// Nullable accepts null besides the type or the reference, encoded the OpenAPI 3.1 way.
+	Nullable bool `json:"-"`
+}
+
+// plainSchema a Schema without its JSON methods.
+type plainSchema Schema
+
+// MarshalJSON adds null to the type of the nullable schemas, or to the reference with anyOf.
+func (schema Schema) MarshalJSON() ([]byte, error) {
+	switch {
+	case !schema.Nullable || (schema.Type == "" && schema.Ref == ""):
+		return json.Marshal(plainSchema(schema))
+	case schema.Ref != "":
+		return json.Marshal(map[string][]*Schema{"anyOf": {{Ref: schema.Ref}, {Type: "null"}}})
+	}
+
+	return json.Marshal(struct {
+		plainSchema
+		Type []string `json:"type"`
+	}{plainSchema: plainSchema(schema), Type: []string{schema.Type, "null"}})
+}
+
+// UnmarshalJSON reads the nullable schemas written by MarshalJSON.
+func (schema *Schema) UnmarshalJSON(data []byte) error {
+	decoded := struct {
+		*plainSchema
+		Type  json.RawMessage `json:"type"`
+		AnyOf []*Schema       `json:"anyOf"`
+	}{plainSchema: (*plainSchema)(schema)}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if len(decoded.AnyOf) == 2 && decoded.AnyOf[1].Type == "null" {
+		schema.Ref, schema.Nullable = decoded.AnyOf[0].Ref, true
+	}
+
+	if len(decoded.Type) == 0 {
+		return nil
+	}
+
+	if decoded.Type[0] != '[' {
+		return json.Unmarshal(decoded.Type, &schema.Type)
+	}
+
+	types := []string{}
+	if err := json.Unmarshal(decoded.Type, &types); err != nil {
+		return err
+	}
+
+	for _, name := range types {
+		if name == "null" {
+			schema.Nullable = true
+		} else {
+			schema.Type = name
+		}
+	}
+
+	return nil
+}
+
+// schemaRegistry builds the schemas of the Go types, registering structs as components.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// schemaFor returns the schema of the type, a reference for structs.
+func (registry *schemaRegistry) schemaFor(valueType reflect.Type) *Schema {
+	for valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+
+	switch valueType {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case numTZDateType:
+		return &Schema{Type: "string", Pattern: numTZDatePattern, Description: "layout " + date.NumTZLayout}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	if reflect.PointerTo(valueType).Implements(textUnmarshalerType) && valueType.Kind() != reflect.Struct {
+		return &Schema{Type: "string"}
+	}
+
+	switch valueType.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: floatPointer(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: registry.schemaFor(valueType.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: registry.schemaFor(valueType.Elem())}
+	case reflect.Struct:
+		if valueType.Name() == "" {
+			schema := &Schema{Type: "object"}
+			registry.fillStruct(schema, valueType)
+
+			return schema
+		}
+
+		return &Schema{Ref: schemaRefPrefix + registry.register(valueType)}
+	default:
+		return &Schema{}
+	}
+}
+
+// register adds the schema of the struct to the components, returning its name.
+func (registry *schemaRegistry) register(structType reflect.Type) string {
+	if name, ok := registry.names[structType]; ok {
+		return name
+	}
+
+	name := schemaName(structType)
+	if _, taken := registry.schemas[name]; taken {
+		name = schemaNameChar.ReplaceAllString(structType.PkgPath(), "_") + "." + name
+	}
+
+	// Registered before building the properties so recursive types reference themselves.
+	schema := &Schema{Type: "object"}
+	registry.names[structType] = name
+	registry.schemas[name] = schema
+
+	registry.fillStruct(schema, structType)
+
+	return name
+}
+
+// fillStruct adds the JSON fields of the struct to the object schema. Fields bound from the URL or the query string
+// are not part of the body and are skipped.
+func (registry *schemaRegistry) fillStruct(schema *Schema, structType reflect.Type) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if source, _ := fieldParamSource(field); source != "" {
+			continue
+		}
+
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && fieldType.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			registry.fillStruct(schema, fieldType)
+
+			continue
+		}
+
+		if schema.Properties == nil {
+			schema.Properties = map[string]*Schema{}
+		}
+
+		property := registry.schemaFor(field.Type)
+		property.Nullable = field.Type.Kind() == reflect.Pointer
+
+		if applyRules(property, field) {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = property
+	}
+}
+
+// applyRules adds the constraints of the validate tag to the schema, returning true if the field is required.
+// Constraints are not added next to references, which only report required.
+func applyRules(schema *Schema, field reflect.StructField) bool {
+	required := false
+
+	for _, rule := range splitRules(field.Tag.Get(validateTag)) {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			required = true
+
+			continue
+		}
+
+		if schema.Ref != "" {
+			continue
+		}
+
+		switch name {
+		case "min", "max", "len":
+			applyBound(schema, name, arg)
+		case "enum":
+			for _, value := range strings.Split(arg, "|") {
+				schema.Enum = append(schema.Enum, value)
+			}
+		case "email":
+			schema.Format = "email"
+		case "regex":
+			schema.Pattern = arg
+		}
+	}
+
+	return required
+}
+
+func applyBound(schema *Schema, name, arg string) {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return
+	}
+
+	intBound := int(bound)
+
+	switch schema.Type {
+	case "string":
+		if name != "max" {
+			schema.MinLength = &intBound
+		}
+
+		if name != "min" {
+			schema.MaxLength = &intBound
+		}
+	case "array":
+		if name != "max" {
+			schema.MinItems = &intBound
+		}
+
+		if name != "min" {
+			schema.MaxItems = &intBound
+		}
+	case "integer", "number":
+		if name != "max" {
+			schema.Minimum = &bound
+		}
+
+		if name != "min" {
+			schema.Maximum = &bound
+		}
+	}
+}
+
+// schemaName returns the component name of the struct, with the type arguments of generic types made safe.
+func schemaName(structType reflect.Type) string {
+	name := structType.Name()
+	if open := strings.Index(name, "["); open >= 0 {
+		arguments := strings.Split(strings.TrimSuffix(name[open+1:], "]"), ",")
+		for i, argument := range arguments {
+			arguments[i] = argument[strings.LastIndex(argument, ".")+1:]
+		}
+
+		name = name[:open] + "_" + strings.Join(arguments, "_")
+	}
+
+	return schemaNameChar.ReplaceAllString(name, "_")
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
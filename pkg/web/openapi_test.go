@@ -0,0 +1,170 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/date"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type documentedAddress struct {
+	Street string `json:"street" validate:"required"`
+}
+
+type documentedOrder struct {
+	ID        uuid.UUID           `json:"id"`
+	Status    string              `json:"status" validate:"enum=open|closed"`
+	Addresses []documentedAddress `json:"addresses"`
+	CreatedAt date.NumTZDate      `json:"created_at"`
+	UpdatedAt *time.Time          `json:"updated_at,omitempty"`
+}
+
+type updateOrderRequest struct {
+	ID     uuid.UUID `param:"id"`
+	DryRun bool      `query:"dry_run" default:"false"`
+	Status string    `json:"status" validate:"required,enum=open|closed"`
+	Notes  string    `json:"notes" validate:"max=200"`
+}
+
+type listOrdersRequest struct {
+	Page  int `query:"page" default:"1" validate:"min=1"`
+	Limit int `query:"limit,required" validate:"min=1,max=100"`
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	router := chi.NewRouter()
+	router.Route("/orders", func(r chi.Router) {
+		r.Method(http.MethodGet, "/", web.Document(web.Operation{
+			Summary:  "List orders",
+			Request:  listOrdersRequest{},
+			Response: web.Paginated[documentedOrder]{},
+		}, noop))
+		r.With(web.Recoverer).Method(http.MethodPatch, "/{id:[0-9a-f-]+}", web.Document(web.Operation{
+			Summary:  "Update an order",
+			Tags:     []string{"orders"},
+			Request:  updateOrderRequest{},
+			Response: documentedOrder{},
+			Errors:   []int{http.StatusNotFound},
+		}, noop))
+		r.Delete("/{id}", noop)
+	})
+
+	document, err := web.GenerateOpenAPI(router, web.OpenAPIInfo{Title: "Orders", Version: "1.0.0"})
+	assert.Nil(t, err, "Document should be generated")
+
+	assert.Equal(t, "3.1.0", document.OpenAPI, "Version is not the expected")
+
+	list := document.Paths["/orders"]["get"]
+	assert.NotNil(t, list, "List operation should be documented")
+	assert.Equal(t, []web.OpenAPIParameter{
+		{Name: "page", In: "query", Schema: &web.Schema{
+			Type: "integer", Format: "int64", Minimum: floatPointer(1), Default: int64(1),
+		}},
+		{Name: "limit", In: "query", Required: true, Schema: &web.Schema{
+			Type: "integer", Format: "int64", Minimum: floatPointer(1), Maximum: floatPointer(100),
+		}},
+	}, list.Parameters, "List parameters are not the expected")
+	assert.Nil(t, list.RequestBody, "Requests without JSON fields should have no body")
+	assert.Equal(t, "#/components/schemas/Paginated_documentedOrder",
+		list.Responses["200"].Content["application/json"].Schema.Ref, "List response is not the expected")
+
+	update := document.Paths["/orders/{id}"]["patch"]
+	assert.NotNil(t, update, "Update operation should be documented")
+	assert.Equal(t, []string{"orders"}, update.Tags, "Tags are not the expected")
+	assert.Equal(t, "path", update.Parameters[0].In, "Path parameter is not the expected")
+	assert.Equal(t, "uuid", update.Parameters[0].Schema.Format, "Path parameter format is not the expected")
+	assert.Equal(t, "#/components/schemas/updateOrderRequest",
+		update.RequestBody.Content["application/json"].Schema.Ref, "Request body is not the expected")
+	assert.Contains(t, update.Responses, "400", "Validation errors should be documented")
+	assert.Contains(t, update.Responses, "404", "Declared errors should be documented")
+
+	deleteOrder := document.Paths["/orders/{id}"]["delete"]
+	assert.NotNil(t, deleteOrder, "Undocumented routes should be listed")
+	assert.Equal(t, "id", deleteOrder.Parameters[0].Name, "Undocumented path parameters should be listed")
+
+	schemas := document.Components.Schemas
+
+	body := schemas["updateOrderRequest"]
+	assert.Equal(t, []string{"status"}, body.Required, "Required fields are not the expected")
+	assert.NotContains(t, body.Properties, "ID", "Parameters should not be part of the body")
+	assert.Equal(t, []interface{}{"open", "closed"}, body.Properties["status"].Enum, "Enum is not the expected")
+	assert.Equal(t, 200, *body.Properties["notes"].MaxLength, "Max length is not the expected")
+
+	order := schemas["documentedOrder"]
+	assert.Empty(t, order.Properties["created_at"].Format, "Layout dates are not date-time")
+	assert.Regexp(t, order.Properties["created_at"].Pattern, "2024-03-01T10:00:00.123-0300",
+		"Date pattern should match the layout")
+	assert.NotRegexp(t, order.Properties["created_at"].Pattern, "2024-03-01T10:00:00.123-03:00",
+		"Date pattern should not match RFC 3339")
+	assert.Equal(t, "date-time", order.Properties["updated_at"].Format, "Time format is not the expected")
+	assert.True(t, order.Properties["updated_at"].Nullable, "Pointer fields should be nullable")
+	assert.False(t, order.Properties["status"].Nullable, "Value fields should not be nullable")
+	assert.Equal(t, "#/components/schemas/documentedAddress", order.Properties["addresses"].Items.Ref,
+		"Nested struct reference is not the expected")
+	assert.Contains(t, schemas, "ErrorResponse", "Error response schema should be registered")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	router := chi.NewRouter()
+	router.Method(http.MethodGet, "/openapi.json", web.OpenAPIHandler(router, web.OpenAPIInfo{Title: "Orders"}))
+	router.Get("/orders", func(w http.ResponseWriter, r *http.Request) {})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code, "Status is not the expected")
+
+	document := web.OpenAPIDocument{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &document), "Document should be JSON")
+	assert.Contains(t, document.Paths, "/orders", "Routes registered later should be documented")
+}
+
+func TestSchema_MarshalJSON_Nullable(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema web.Schema
+		wanted string
+	}{
+		{
+			name:   "Nullable type",
+			schema: web.Schema{Type: "string", Format: "date-time", Nullable: true},
+			wanted: `{"type":["string","null"],"format":"date-time"}`,
+		},
+		{
+			name:   "Nullable reference",
+			schema: web.Schema{Ref: "#/components/schemas/documentedAddress", Nullable: true},
+			wanted: `{"anyOf":[{"$ref":"#/components/schemas/documentedAddress"},{"type":"null"}]}`,
+		},
+		{
+			name:   "Not nullable type",
+			schema: web.Schema{Type: "string"},
+			wanted: `{"type":"string"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.schema)
+			assert.Nil(t, err, "Unexpected error encoding schema")
+			assert.JSONEq(t, tt.wanted, string(encoded), "Encoded schema is not the expected")
+
+			decoded := web.Schema{}
+			assert.Nil(t, json.Unmarshal(encoded, &decoded), "Unexpected error decoding schema")
+			assert.Equal(t, tt.schema, decoded, "Decoded schema is not the expected")
+		})
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
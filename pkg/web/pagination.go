@@ -0,0 +1,239 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	defaultMaxLimit  = 100
+
+	pageParam   = "page"
+	limitParam  = "limit"
+	cursorParam = "cursor"
+)
+
+// PageOptions the bounds of the pagination parameters.
+type PageOptions struct {
+	// DefaultLimit the limit of requests without one. Zero means 20.
+	DefaultLimit int
+	// MaxLimit the greatest limit a request can ask for. Zero means 100.
+	MaxLimit int
+}
+
+// Page the pagination parameters of a request: either a page number or an opaque cursor, and the page size.
+type Page struct {
+	// Number the 1-based page number, zero when paginating with a cursor.
+	Number int
+	Limit  int
+	// Cursor the cursor of the page, empty for the first page or when paginating by number.
+	Cursor string
+}
+
+// Offset returns the number of items before the page, for LIMIT/OFFSET queries.
+func (page Page) Offset() int {
+	if page.Number <= 1 {
+		return 0
+	}
+
+	return (page.Number - 1) * page.Limit
+}
+
+// ParsePage parses the page and limit query parameters, or the cursor and limit ones. Missing parameters default to
+// the first page and the default limit. A limit out of bounds, a page lower than one or a page combined with a
+// cursor is reported with a ParamError.
+func ParsePage(r *http.Request, opts PageOptions) (Page, error) {
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = defaultPageLimit
+	}
+
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = defaultMaxLimit
+	}
+
+	query := r.URL.Query()
+
+	limit, err := QueryParamOr(r, limitParam, ParseInt, opts.DefaultLimit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	if limit < 1 || limit > opts.MaxLimit {
+		return Page{}, &ParamError{
+			Source: QueryParamSource,
+			Name:   limitParam,
+			Value:  query.Get(limitParam),
+			Reason: fmt.Sprintf("must be between 1 and %d", opts.MaxLimit),
+		}
+	}
+
+	cursor := query.Get(cursorParam)
+
+	if cursor != "" {
+		if query.Get(pageParam) != "" {
+			return Page{}, &ParamError{
+				Source: QueryParamSource,
+				Name:   pageParam,
+				Value:  query.Get(pageParam),
+				Reason: "cannot be combined with a cursor",
+			}
+		}
+
+		return Page{Limit: limit, Cursor: cursor}, nil
+	}
+
+	number, err := QueryParamOr(r, pageParam, ParseInt, 1)
+	if err != nil {
+		return Page{}, err
+	}
+
+	if number < 1 {
+		return Page{}, &ParamError{
+			Source: QueryParamSource,
+			Name:   pageParam,
+			Value:  query.Get(pageParam),
+			Reason: "must be greater than zero",
+		}
+	}
+
+	return Page{Number: number, Limit: limit}, nil
+}
+
+// EncodeCursor encodes the position of a page, such as the sort key of its last item, as an opaque cursor.
+func EncodeCursor(position interface{}) (string, error) {
+	encoded, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor into position. Malformed cursors are reported with a
+// ParamError.
+func DecodeCursor(cursor string, position interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(decoded, position)
+	}
+
+	if err != nil {
+		return &ParamError{Source: QueryParamSource, Name: cursorParam, Value: cursor, Reason: "is not valid"}
+	}
+
+	return nil
+}
+
+// Paginated the envelope of paginated list responses. It implements Headerer to emit the RFC 8288 Link header with
+// the first, prev, next and last pages, so EncodeJSON and Encode render both the body and the links.
+type Paginated[T any] struct {
+	Items []T `json:"items"`
+	// Total the number of items of every page, omitted when it is unknown.
+	Total      *int64 `json:"total,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+
+	links []pageLink
+}
+
+type pageLink struct {
+	rel string
+	url string
+}
+
+// NewPaginated creates the response of a page requested by number. total is the number of items of every page.
+func NewPaginated[T any](r *http.Request, page Page, items []T, total int64) Paginated[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	paginated := Paginated[T]{Items: items, Total: &total, Page: page.Number, Limit: page.Limit}
+
+	lastPage := 1
+	if page.Limit > 0 && total > 0 {
+		lastPage = int((total + int64(page.Limit) - 1) / int64(page.Limit))
+	}
+
+	pageURL := func(number int) string {
+		return linkURL(r, map[string]string{pageParam: strconv.Itoa(number), limitParam: strconv.Itoa(page.Limit)})
+	}
+
+	paginated.links = append(paginated.links, pageLink{rel: "first", url: pageURL(1)})
+
+	if page.Number > 1 {
+		paginated.links = append(paginated.links, pageLink{rel: "prev", url: pageURL(min(page.Number-1, lastPage))})
+	}
+
+	if page.Number < lastPage {
+		paginated.links = append(paginated.links, pageLink{rel: "next", url: pageURL(page.Number + 1)})
+	}
+
+	paginated.links = append(paginated.links, pageLink{rel: "last", url: pageURL(lastPage)})
+
+	return paginated
+}
+
+// NewCursorPaginated creates the response of a page requested by cursor. Empty cursors mean there is no next or
+// previous page.
+func NewCursorPaginated[T any](r *http.Request, page Page, items []T, nextCursor, prevCursor string) Paginated[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	paginated := Paginated[T]{Items: items, Limit: page.Limit, NextCursor: nextCursor, PrevCursor: prevCursor}
+
+	cursorURL := func(cursor string) string {
+		return linkURL(r, map[string]string{cursorParam: cursor, limitParam: strconv.Itoa(page.Limit)})
+	}
+
+	if prevCursor != "" {
+		paginated.links = append(paginated.links, pageLink{rel: "prev", url: cursorURL(prevCursor)})
+	}
+
+	if nextCursor != "" {
+		paginated.links = append(paginated.links, pageLink{rel: "next", url: cursorURL(nextCursor)})
+	}
+
+	return paginated
+}
+
+// WithTotal sets the total number of items of a cursor paginated response.
+func (paginated Paginated[T]) WithTotal(total int64) Paginated[T] {
+	paginated.Total = &total
+
+	return paginated
+}
+
+// Headers returns the Link header of the pages.
+func (paginated Paginated[T]) Headers() http.Header {
+	header := http.Header{}
+
+	for _, link := range paginated.links {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, link.url, link.rel))
+	}
+
+	return header
+}
+
+// linkURL returns the path and query of the request with the pagination parameters replaced. The links are relative
+// so they stay valid behind proxies rewriting the host.
+func linkURL(r *http.Request, params map[string]string) string {
+	query := r.URL.Query()
+	query.Del(pageParam)
+	query.Del(cursorParam)
+
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+
+	return link.String()
+}
@@ -0,0 +1,115 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantPage web.Page
+		wantErr  string
+	}{
+		{
+			name:     "Defaults",
+			wantPage: web.Page{Number: 1, Limit: 20},
+		},
+		{
+			name:     "Page and limit",
+			query:    "?page=3&limit=50",
+			wantPage: web.Page{Number: 3, Limit: 50},
+		},
+		{
+			name:     "Cursor",
+			query:    "?cursor=abc&limit=10",
+			wantPage: web.Page{Limit: 10, Cursor: "abc"},
+		},
+		{
+			name:    "Limit over the maximum",
+			query:   "?limit=500",
+			wantErr: `query parameter "limit" must be between 1 and 100`,
+		},
+		{
+			name:    "Page lower than one",
+			query:   "?page=0",
+			wantErr: `query parameter "page" must be greater than zero`,
+		},
+		{
+			name:    "Page combined with a cursor",
+			query:   "?page=2&cursor=abc",
+			wantErr: `query parameter "page" cannot be combined with a cursor`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil)
+
+			page, err := web.ParsePage(req, web.PageOptions{})
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr, "Error is not the expected")
+
+				return
+			}
+
+			assert.Nil(t, err, "Page should be valid")
+			assert.Equal(t, tt.wantPage, page, "Page is not the expected")
+		})
+	}
+}
+
+func TestNewPaginated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/orders?status=open&page=2&limit=10", nil)
+	page, err := web.ParsePage(req, web.PageOptions{})
+	assert.Nil(t, err, "Page should be valid")
+
+	assert.Equal(t, 10, page.Offset(), "Offset is not the expected")
+
+	recorder := httptest.NewRecorder()
+	assert.Nil(t, web.EncodeJSON(recorder, web.NewPaginated(req, page, []int{11, 12}, 35), http.StatusOK),
+		"Encoding should not fail")
+
+	assert.JSONEq(t, `{"items":[11,12],"total":35,"page":2,"limit":10}`, recorder.Body.String(),
+		"Body is not the expected")
+	assert.Equal(t, []string{
+		`</orders?limit=10&page=1&status=open>; rel="first"`,
+		`</orders?limit=10&page=1&status=open>; rel="prev"`,
+		`</orders?limit=10&page=3&status=open>; rel="next"`,
+		`</orders?limit=10&page=4&status=open>; rel="last"`,
+	}, recorder.Header().Values("Link"), "Links are not the expected")
+}
+
+func TestNewCursorPaginated(t *testing.T) {
+	type position struct {
+		ID int `json:"id"`
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?limit=2", nil)
+	page, err := web.ParsePage(req, web.PageOptions{})
+	assert.Nil(t, err, "Page should be valid")
+
+	next, err := web.EncodeCursor(position{ID: 2})
+	assert.Nil(t, err, "Cursor should be encoded")
+
+	decoded := position{}
+	assert.Nil(t, web.DecodeCursor(next, &decoded), "Cursor should be decoded")
+	assert.Equal(t, 2, decoded.ID, "Decoded cursor is not the expected")
+	assert.Error(t, web.DecodeCursor("not a cursor", &decoded), "Malformed cursors should fail")
+
+	recorder := httptest.NewRecorder()
+	assert.Nil(t, web.EncodeJSON(recorder, web.NewCursorPaginated(req, page, []int{1, 2}, next, ""),
+		http.StatusOK), "Encoding should not fail")
+
+	assert.JSONEq(t, `{"items":[1,2],"limit":2,"next_cursor":"`+next+`"}`, recorder.Body.String(),
+		"Body is not the expected")
+	assert.Equal(t, []string{`</orders?cursor=` + next + `&limit=2>; rel="next"`}, recorder.Header().Values("Link"),
+		"Links are not the expected")
+}
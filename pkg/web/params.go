@@ -0,0 +1,207 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/adminvoras/commons-lib/pkg/date"
+)
+
+// ParamSource the part of the request a parameter is read from.
+type ParamSource string
+
+const (
+	URLParamSource   ParamSource = "url"
+	QueryParamSource ParamSource = "query"
+)
+
+// ParamError an error caused by a missing or malformed URL or query parameter.
+type ParamError struct {
+	Source ParamSource
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (err *ParamError) Error() string {
+	return fmt.Sprintf("%s parameter %q %s", err.Source, err.Name, err.Reason)
+}
+
+func (err *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// ParamParser converts a raw parameter value into T.
+// The returned error message completes the sentence "parameter x ...".
+type ParamParser[T any] func(value string) (T, error)
+
+// ParseString returns the value as it is.
+func ParseString(value string) (string, error) {
+	return value, nil
+}
+
+// ParseInt parses the value as an int.
+func ParseInt(value string) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer")
+	}
+
+	return parsed, nil
+}
+
+// ParseInt64 parses the value as an int64.
+func ParseInt64(value string) (int64, error) {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer")
+	}
+
+	return parsed, nil
+}
+
+// ParseUint parses the value as an uint.
+func ParseUint(value string) (uint, error) {
+	parsed, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("must be a non negative integer")
+	}
+
+	return uint(parsed), nil
+}
+
+// ParseBool parses the value as a bool, accepting the values supported by strconv.ParseBool.
+func ParseBool(value string) (bool, error) {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("must be a boolean")
+	}
+
+	return parsed, nil
+}
+
+// ParseFloat parses the value as a float64.
+func ParseFloat(value string) (float64, error) {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number")
+	}
+
+	return parsed, nil
+}
+
+// ParseUUID parses the value as an UUID.
+func ParseUUID(value string) (uuid.UUID, error) {
+	parsed, err := uuid.FromString(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("must be an UUID")
+	}
+
+	return parsed, nil
+}
+
+// ParseTime returns a parser trying the given layouts in order. Without layouts it accepts the date.NumTZDate layout
+// and RFC 3339. Parsed times are converted to UTC like the pkg/date types do.
+func ParseTime(layouts ...string) ParamParser[time.Time] {
+	if len(layouts) == 0 {
+		layouts = []string{date.NumTZLayout, time.RFC3339Nano}
+	}
+
+	return func(value string) (time.Time, error) {
+		for _, layout := range layouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed.UTC(), nil
+			}
+		}
+
+		return time.Time{}, fmt.Errorf("must be a time with layout %s", strings.Join(layouts, " or "))
+	}
+}
+
+// ParseEnum returns a parser accepting only the given values.
+func ParseEnum(allowed ...string) ParamParser[string] {
+	return func(value string) (string, error) {
+		for _, option := range allowed {
+			if value == option {
+				return value, nil
+			}
+		}
+
+		return "", fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// URLParam returns the required URL parameter parsed as T.
+func URLParam[T any](r *http.Request, key string, parse ParamParser[T]) (T, error) {
+	return requiredParam(URLParamSource, key, Param(r, key), parse)
+}
+
+// URLParamOr returns the URL parameter parsed as T, or def if it is missing.
+func URLParamOr[T any](r *http.Request, key string, parse ParamParser[T], def T) (T, error) {
+	return defaultParam(URLParamSource, key, Param(r, key), parse, def)
+}
+
+// URLParamOptional returns the URL parameter parsed as T, or nil if it is missing.
+func URLParamOptional[T any](r *http.Request, key string, parse ParamParser[T]) (*T, error) {
+	return optionalParam(URLParamSource, key, Param(r, key), parse)
+}
+
+// QueryParam returns the required query string parameter parsed as T.
+func QueryParam[T any](r *http.Request, key string, parse ParamParser[T]) (T, error) {
+	return requiredParam(QueryParamSource, key, r.URL.Query().Get(key), parse)
+}
+
+// QueryParamOr returns the query string parameter parsed as T, or def if it is missing.
+func QueryParamOr[T any](r *http.Request, key string, parse ParamParser[T], def T) (T, error) {
+	return defaultParam(QueryParamSource, key, r.URL.Query().Get(key), parse, def)
+}
+
+// QueryParamOptional returns the query string parameter parsed as T, or nil if it is missing.
+func QueryParamOptional[T any](r *http.Request, key string, parse ParamParser[T]) (*T, error) {
+	return optionalParam(QueryParamSource, key, r.URL.Query().Get(key), parse)
+}
+
+func requiredParam[T any](source ParamSource, key, value string, parse ParamParser[T]) (T, error) {
+	if value == "" {
+		var zero T
+
+		return zero, &ParamError{Source: source, Name: key, Reason: "is required"}
+	}
+
+	return parseParam(source, key, value, parse)
+}
+
+func defaultParam[T any](source ParamSource, key, value string, parse ParamParser[T], def T) (T, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	return parseParam(source, key, value, parse)
+}
+
+func optionalParam[T any](source ParamSource, key, value string, parse ParamParser[T]) (*T, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := parseParam(source, key, value, parse)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
+
+func parseParam[T any](source ParamSource, key, value string, parse ParamParser[T]) (T, error) {
+	parsed, err := parse(value)
+	if err != nil {
+		return parsed, &ParamError{Source: source, Name: key, Value: value, Reason: err.Error()}
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,136 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/date"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestURLParam(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req = web.WithURLParams(t, req, map[string]string{"id": "42", "name": "john"})
+
+	id, err := web.URLParam(req, "id", web.ParseInt64)
+	assert.Nil(t, err, "Unexpected error reading id")
+	assert.Equal(t, int64(42), id, "Id is not the expected")
+
+	_, err = web.URLParam(req, "name", web.ParseInt64)
+	assert.Equal(t,
+		&web.ParamError{Source: web.URLParamSource, Name: "name", Value: "john", Reason: "must be an integer"}, err,
+		"Error is not the expected")
+
+	_, err = web.URLParam(req, "missing", web.ParseUUID)
+	assert.Equal(t, `url parameter "missing" is required`, err.Error(), "Error is not the expected")
+}
+
+func TestQueryParam(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/orders?status=open&active=true&since=2020-01-21T13:24:32.123-0300",
+		nil)
+
+	status, err := web.QueryParam(req, "status", web.ParseEnum("open", "closed"))
+	assert.Nil(t, err, "Unexpected error reading status")
+	assert.Equal(t, "open", status, "Status is not the expected")
+
+	active, err := web.QueryParamOr(req, "active", web.ParseBool, false)
+	assert.Nil(t, err, "Unexpected error reading active")
+	assert.True(t, active, "Active is not the expected")
+
+	page, err := web.QueryParamOr(req, "page", web.ParseUint, 1)
+	assert.Nil(t, err, "Unexpected error reading page")
+	assert.Equal(t, uint(1), page, "Default page is not the expected")
+
+	limit, err := web.QueryParamOptional(req, "limit", web.ParseInt)
+	assert.Nil(t, err, "Unexpected error reading limit")
+	assert.Nil(t, limit, "Missing optional parameter should be nil")
+
+	since, err := web.QueryParam(req, "since", web.ParseTime(date.NumTZLayout))
+	assert.Nil(t, err, "Unexpected error reading since")
+	assert.Equal(t, time.Date(2020, 1, 21, 16, 24, 32, 123*int(time.Millisecond), time.UTC), since,
+		"Since is not the expected")
+
+	_, err = web.QueryParam(req, "status", web.ParseEnum("pending"))
+	assert.Equal(t, `query parameter "status" must be one of pending`, err.Error(), "Error is not the expected")
+}
+
+func TestBindParams(t *testing.T) {
+	type listOrders struct {
+		UserID uuid.UUID       `param:"user_id"`
+		Status string          `query:"status,required" validate:"enum=open|closed"`
+		Page   int             `query:"page" default:"1" validate:"min=1"`
+		Since  *date.NumTZDate `query:"since"`
+		Day    time.Time       `query:"day" layout:"2006-01-02"`
+		IDs    []int64         `query:"id"`
+	}
+
+	userID := uuid.Must(uuid.NewV4())
+
+	tests := []struct {
+		name      string
+		target    string
+		want      listOrders
+		wantedErr error
+	}{
+		{
+			name:   "Parameters are bound",
+			target: "/orders?status=open&day=2024-05-01&id=1&id=2",
+			want: listOrders{
+				UserID: userID,
+				Status: "open",
+				Page:   1,
+				Day:    time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				IDs:    []int64{1, 2},
+			},
+		},
+		{
+			name:      "Missing required parameter is rejected",
+			target:    "/orders",
+			wantedErr: &web.ParamError{Source: web.QueryParamSource, Name: "status", Reason: "is required"},
+		},
+		{
+			name:   "Malformed parameter is rejected",
+			target: "/orders?status=open&page=first",
+			wantedErr: &web.ParamError{Source: web.QueryParamSource, Name: "page", Value: "first",
+				Reason: "must be an integer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = web.WithURLParams(t, req, map[string]string{"user_id": userID.String()})
+
+			got := listOrders{}
+			err := web.BindParams(req, &got)
+
+			if tt.wantedErr != nil {
+				assert.Equal(t, tt.wantedErr, err, "Error is not the expected")
+
+				return
+			}
+
+			assert.Nil(t, err, "Unexpected error binding parameters")
+			assert.Equal(t, tt.want, got, "Bound parameters are not the expected")
+		})
+	}
+}
+
+func TestBindParams_Validation(t *testing.T) {
+	type listOrders struct {
+		Status string `query:"status" validate:"enum=open|closed"`
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?status=pending", nil)
+
+	err := web.BindParams(req, &listOrders{})
+
+	var validationErr *web.ValidationError
+	assert.True(t, errors.As(err, &validationErr), "Error should be a validation error")
+}
@@ -0,0 +1,293 @@
+package web
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	rateLimitSweepInterval = time.Minute
+	unmatchedRouteName     = "unmatched"
+)
+
+// RateLimit a token bucket limit: Rate tokens are refilled every Period up to Burst tokens.
+type RateLimit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// RateLimitResult the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter how long to wait until a token is available, when the request was not allowed.
+	RetryAfter time.Duration
+	// Reset how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the token buckets of the rate limiter.
+type RateLimitStore interface {
+	// Take consumes a token from the bucket of the key.
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns the key identifying the client of the request.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitOptions the options of the rate limit middleware.
+type RateLimitOptions struct {
+	// Name the bucket namespace, shared by every limiter with the same name. Empty means the method and route
+	// pattern under a namespace of the limiter, so every route gets its own buckets and limiters never share them.
+	// Requests matching no route share a single namespace. Set it when the Store is shared between replicas, since
+	// the limiter namespaces depend on the order the limiters are created.
+	Name string
+	// Limit the token bucket limit. A zero Burst means Rate.
+	Limit RateLimit
+	// KeyFunc identifies the client. Nil means KeyByIP.
+	KeyFunc RateLimitKeyFunc
+	// Store keeps the buckets. Nil means an in-memory store shared by every limiter.
+	Store RateLimitStore
+}
+
+// rateLimiter the rate limit middleware source, used as the Class tag of the log lines.
+type rateLimiter struct {
+	opts RateLimitOptions
+	// id the namespace of the buckets of an unnamed limiter.
+	id uint64
+}
+
+var (
+	defaultRateLimitStore = NewMemoryRateLimitStore()
+	rateLimiterIDs        atomic.Uint64
+)
+
+// KeyByIP identifies clients by their IP address. Use it after chi's RealIP middleware behind proxies.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// KeyByHeader identifies clients by the value of the header, falling back to the IP address when it is missing.
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(header); value != "" {
+			return header + ":" + value
+		}
+
+		return KeyByIP(r)
+	}
+}
+
+// KeyBySubject identifies clients by their authenticated subject, falling back to the IP address for anonymous
+// requests.
+func KeyBySubject(r *http.Request) string {
+	if subject := SubjectFromContext(r.Context()); subject != "" {
+		return "subject:" + subject
+	}
+
+	return KeyByIP(r)
+}
+
+// RateLimiter returns a middleware limiting the requests of every client with a token bucket. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and rejected requests get a JSON 429 with a
+// Retry-After header. It can be mounted with Use before routing, or per route with chi's With or Group to configure
+// different limits. Both can be combined on the same route, since unnamed limiters never share buckets. It returns an
+// error if the limit is not valid.
+func RateLimiter(opts RateLimitOptions) (func(http.Handler) http.Handler, error) {
+	if opts.Limit.Rate <= 0 || opts.Limit.Period <= 0 {
+		return nil, voraserror.New(nil, "rate limit rate and period must be greater than zero")
+	}
+
+	if opts.Limit.Burst < 0 {
+		return nil, voraserror.New(nil, "rate limit burst cannot be negative")
+	}
+
+	if opts.Limit.Burst == 0 {
+		opts.Limit.Burst = opts.Limit.Rate
+	}
+
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = KeyByIP
+	}
+
+	if opts.Store == nil {
+		opts.Store = defaultRateLimitStore
+	}
+
+	limiter := &rateLimiter{opts: opts, id: rateLimiterIDs.Add(1)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := limiter.opts.Store.Take(limiter.bucketKey(r), limiter.opts.Limit)
+			if err != nil {
+				// Fail open: an unavailable store must not take the service down.
+				log.FromContext(r.Context()).Error(limiter, nil, err, "Error taking rate limit token")
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(limiter.opts.Limit.Burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+
+				_ = EncodeJSON(w, ErrorResponse{
+					Status:  http.StatusTooManyRequests,
+					Message: "rate limit exceeded",
+				}, http.StatusTooManyRequests)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func (limiter *rateLimiter) bucketKey(r *http.Request) string {
+	name := limiter.opts.Name
+	if name == "" {
+		name = strconv.FormatUint(limiter.id, 10) + " " + r.Method + " " + routePattern(r)
+	}
+
+	return name + "|" + limiter.opts.KeyFunc(r)
+}
+
+// routePattern returns the pattern of the route the request matches. Middlewares mounted with Use run before the
+// router picks the route, so the pattern is resolved ahead by matching the remaining path, never falling back to the
+// path itself, which would give every URL parameter value its own bucket.
+func routePattern(r *http.Request) string {
+	routeContext := chi.RouteContext(r.Context())
+	if routeContext == nil {
+		return unmatchedRouteName
+	}
+
+	pattern := routeContext.RoutePattern()
+	if pattern != "" && !strings.HasSuffix(pattern, "/*") {
+		return pattern
+	}
+
+	if routeContext.Routes == nil {
+		return unmatchedRouteName
+	}
+
+	routePath := routeContext.RoutePath
+	if routePath == "" {
+		routePath = r.URL.RawPath
+		if routePath == "" {
+			routePath = r.URL.Path
+		}
+	}
+
+	matched := chi.NewRouteContext()
+	matched.RoutePatterns = append(matched.RoutePatterns, routeContext.RoutePatterns...)
+
+	if !routeContext.Routes.Match(matched, r.Method, routePath) {
+		return unmatchedRouteName
+	}
+
+	return matched.RoutePattern()
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+type tokenBucket struct {
+	tokens   float64
+	burst    float64
+	perToken time.Duration
+	last     time.Time
+}
+
+// refill adds the tokens accumulated since the last use.
+func (bucket *tokenBucket) refill(now time.Time) {
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+float64(now.Sub(bucket.last))/float64(bucket.perToken))
+	bucket.last = now
+}
+
+// memoryRateLimitStore an in-memory RateLimitStore. Full buckets are dropped periodically to bound its memory.
+type memoryRateLimitStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore creates an in-memory rate limit store. Buckets are local to the process, so each replica
+// of a service enforces its own limit.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (store *memoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := store.now()
+	perToken := limit.Period / time.Duration(limit.Rate)
+	burst := float64(limit.Burst)
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		store.buckets[key] = bucket
+	}
+
+	bucket.burst, bucket.perToken = burst, perToken
+	bucket.refill(now)
+
+	result := RateLimitResult{}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((burst - bucket.tokens) * float64(perToken))
+
+	if now.Sub(store.lastSweep) >= rateLimitSweepInterval {
+		store.sweep(now)
+	}
+
+	return result, nil
+}
+
+// sweep drops the full buckets, which behave the same as missing ones. The mutex must be held.
+func (store *memoryRateLimitStore) sweep(now time.Time) {
+	store.lastSweep = now
+
+	for key, bucket := range store.buckets {
+		if bucket.refill(now); bucket.tokens >= bucket.burst {
+			delete(store.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	voraserrors "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := web.RateLimiter(web.RateLimitOptions{
+		Limit:   web.RateLimit{Rate: 2, Period: time.Minute},
+		KeyFunc: web.KeyByHeader("X-Api-Key"),
+		Store:   web.NewMemoryRateLimitStore(),
+	})
+	assert.Nil(t, err, "Unexpected error creating rate limiter")
+
+	router := chi.NewRouter()
+	router.With(limiter).Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	first := request("client-a")
+	assert.Equal(t, http.StatusOK, first.Code, "First request should be allowed")
+	assert.Equal(t, "2", first.Header().Get("RateLimit-Limit"), "Limit header is not the expected")
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Remaining"), "Remaining header is not the expected")
+
+	assert.Equal(t, http.StatusOK, request("client-a").Code, "Second request should be allowed")
+
+	rejected := request("client-a")
+	assert.Equal(t, http.StatusTooManyRequests, rejected.Code, "Third request should be rejected")
+	assert.Equal(t, "30", rejected.Header().Get("Retry-After"), "Retry after header is not the expected")
+	assert.JSONEq(t, `{"status":429,"message":"rate limit exceeded"}`, rejected.Body.String(),
+		"Body is not the expected")
+
+	assert.Equal(t, http.StatusOK, request("client-b").Code, "Other clients should have their own bucket")
+}
+
+func TestRateLimiter_BucketPerRoutePattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		mount func(router chi.Router, limiter func(http.Handler) http.Handler, handler http.HandlerFunc)
+	}{
+		{
+			name: "Limiter mounted before routing",
+			mount: func(router chi.Router, limiter func(http.Handler) http.Handler, handler http.HandlerFunc) {
+				router.Use(limiter)
+				router.Get("/orders/{id}", handler)
+			},
+		},
+		{
+			name: "Limiter mounted in a sub-router",
+			mount: func(router chi.Router, limiter func(http.Handler) http.Handler, handler http.HandlerFunc) {
+				router.Route("/orders", func(router chi.Router) {
+					router.Use(limiter)
+					router.Get("/{id}", handler)
+				})
+			},
+		},
+		{
+			name: "Limiter mounted per route",
+			mount: func(router chi.Router, limiter func(http.Handler) http.Handler, handler http.HandlerFunc) {
+				router.With(limiter).Get("/orders/{id}", handler)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := web.RateLimiter(web.RateLimitOptions{
+				Limit: web.RateLimit{Rate: 2, Period: time.Minute},
+				Store: web.NewMemoryRateLimitStore(),
+			})
+			assert.Nil(t, err, "Unexpected error creating rate limiter")
+
+			router := chi.NewRouter()
+			tt.mount(router, limiter, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			codes := []int{}
+			for _, path := range []string{"/orders/1", "/orders/2", "/orders/3"} {
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+				codes = append(codes, recorder.Code)
+			}
+
+			assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes,
+				"Every order ID should share the route bucket")
+		})
+	}
+}
+
+func TestRateLimiter_InvalidLimit(t *testing.T) {
+	_, err := web.RateLimiter(web.RateLimitOptions{Limit: web.RateLimit{Rate: 0, Period: time.Minute}})
+
+	assert.Equal(t, voraserrors.New(nil, "rate limit rate and period must be greater than zero"), err,
+		"Error is not the expected")
+}
+
+func TestKeyBySubject(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	assert.Equal(t, "10.0.0.1", web.KeyBySubject(req), "Anonymous requests should be keyed by IP")
+
+	req = req.WithContext(web.WithSubject(req.Context(), "user-1"))
+
+	assert.Equal(t, "subject:user-1", web.KeyBySubject(req), "Authenticated requests should be keyed by subject")
+}
+
+func TestRateLimiter_GlobalAndPerRouteLimiters(t *testing.T) {
+	global, err := web.RateLimiter(web.RateLimitOptions{Limit: web.RateLimit{Rate: 3, Period: time.Minute}})
+	assert.Nil(t, err, "Unexpected error creating global rate limiter")
+
+	perRoute, err := web.RateLimiter(web.RateLimitOptions{Limit: web.RateLimit{Rate: 2, Period: time.Minute}})
+	assert.Nil(t, err, "Unexpected error creating per route rate limiter")
+
+	router := chi.NewRouter()
+	router.Use(global)
+	router.With(perRoute).Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	codes := []int{}
+	remaining := []string{}
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		codes = append(codes, recorder.Code)
+		remaining = append(remaining, recorder.Header().Get("RateLimit-Remaining"))
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes,
+		"Each request should take one token of each limiter")
+	assert.Equal(t, []string{"1", "0", "0"}, remaining, "Remaining header is not the expected")
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+// recoverer the panic recovery source, used as the Class tag of the log lines.
+type recoverer struct{}
+
+// Recoverer is a middleware that recovers from panics, logs the panic value and its stack trace with the request
+// logger of pkg/log and responds with a JSON internal server error. http.ErrAbortHandler is re-panicked so the server
+// aborts the response as expected. Responses whose header was already sent are left as they are, since the status can
+// no longer change. It must run after RequestID to log the request ID.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			err, ok := rvr.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rvr)
+			}
+
+			log.FromContext(r.Context()).Error(recoverer{}, map[string]string{"stack": string(debug.Stack())}, err,
+				"Panic recovered serving %s %s", r.Method, r.URL.Path)
+
+			// Upgraded connections no longer speak HTTP, so there is no response to write.
+			if r.Header.Get("Connection") == "Upgrade" || ww.Status() != 0 {
+				return
+			}
+
+			_ = EncodeJSON(ww, ErrorResponse{
+				Status:  http.StatusInternalServerError,
+				Message: http.StatusText(http.StatusInternalServerError),
+			}, http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,66 @@
+package web_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/utils/logger"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestRecoverer(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger.SetLogLevel("debug")
+	logger.Log.Out = buffer
+
+	defer func() {
+		logger.Log.Out = os.Stdout
+	}()
+
+	handler := web.RequestID(web.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(web.RequestIDHeader, "the-request-id")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code, "Status is not the expected")
+	assert.JSONEq(t, `{"status":500,"message":"Internal Server Error"}`, recorder.Body.String(),
+		"Body is not the expected")
+	assert.Contains(t, buffer.String(), "something went wrong", "Panic value should be logged")
+	assert.Contains(t, buffer.String(), "[Request_ID:the-request-id]", "Request ID should be logged")
+	assert.Contains(t, buffer.String(), "[stack:", "Stack trace should be logged")
+}
+
+func TestRecoverer_HeaderAlreadyWritten(t *testing.T) {
+	handler := web.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"items":[`))
+
+		panic("something went wrong")
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code, "Status is not the expected")
+	assert.Equal(t, `{"items":[`, recorder.Body.String(), "Error should not be appended to the body")
+}
+
+func TestRecoverer_AbortHandler(t *testing.T) {
+	handler := web.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}, "ErrAbortHandler should be re-panicked")
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	// RequestIDHeader the header carrying the request ID between services.
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID is a middleware that reads the request ID from the X-Request-ID header, or generates one when it is
+// missing or malformed, echoes it in the response and stores a logger tagged with it in the request context.
+// Handlers retrieve the logger with log.FromContext and the ID with RequestIDFromContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := log.WithLogger(r.Context(), log.NewLogger(requestID))
+		// Keep chi's request ID in sync so its middlewares log the same ID.
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, requestID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID stored by the RequestID middleware, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+// validRequestID accepts non empty printable ASCII IDs of a reasonable length so they are safe to log and echo.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID generates a request ID the same way log.DefaultLogger does.
+func newRequestID() string {
+	return log.DefaultLogger().GetRequestID()
+}
@@ -0,0 +1,60 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantEqual bool
+	}{
+		{
+			name:      "Incoming request ID is propagated",
+			header:    "the-request-id",
+			wantEqual: true,
+		},
+		{
+			name:      "Missing request ID is generated",
+			header:    "",
+			wantEqual: false,
+		},
+		{
+			name:      "Malformed request ID is replaced",
+			header:    strings.Repeat("a", 200),
+			wantEqual: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loggerID, contextID string
+
+			handler := web.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				loggerID = log.FromContext(r.Context()).GetRequestID()
+				contextID = web.RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(web.RequestIDHeader, tt.header)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			responseID := recorder.Header().Get(web.RequestIDHeader)
+			assert.NotEmpty(t, responseID, "Response should carry the request ID")
+			assert.Equal(t, responseID, loggerID, "Logger request ID is not the expected")
+			assert.Equal(t, responseID, contextID, "Context request ID is not the expected")
+			assert.Equal(t, tt.wantEqual, responseID == tt.header, "Request ID propagation is not the expected")
+		})
+	}
+}
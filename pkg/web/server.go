@@ -0,0 +1,351 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	voraserror "github.com/adminvoras/commons-lib/pkg/errors"
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+const (
+	defaultServerAddress     = ":8080"
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 15 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultShutdownTimeout   = 20 * time.Second
+	defaultDrainDelay        = 5 * time.Second
+	defaultLivenessPath      = "/health/live"
+	defaultReadinessPath     = "/health/ready"
+)
+
+// ReadinessCheck reports whether a dependency of the server is ready to receive traffic.
+type ReadinessCheck func(ctx context.Context) error
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Server the HTTP server interface.
+type Server interface {
+	// Router returns the router where the service routes are mounted.
+	Router() chi.Router
+	// Run listens on the configured address until the context is cancelled or the process receives SIGINT or
+	// SIGTERM. It then fails the readiness probe during the drain delay, while still serving requests, and finally
+	// drains the in-flight requests during the shutdown timeout.
+	Run(ctx context.Context) error
+}
+
+// ServerBuilder the HTTP server builder interface.
+type ServerBuilder interface {
+	WithAddress(address string) ServerBuilder
+	WithReadHeaderTimeout(timeout time.Duration) ServerBuilder
+	WithReadTimeout(timeout time.Duration) ServerBuilder
+	WithWriteTimeout(timeout time.Duration) ServerBuilder
+	WithIdleTimeout(timeout time.Duration) ServerBuilder
+	WithShutdownTimeout(timeout time.Duration) ServerBuilder
+	WithDrainDelay(delay time.Duration) ServerBuilder
+	WithMiddlewares(middlewares ...func(http.Handler) http.Handler) ServerBuilder
+	WithHealthPaths(livenessPath, readinessPath string) ServerBuilder
+	WithReadinessCheck(check ReadinessCheck) ServerBuilder
+	WithAccessLog(opts AccessLogOptions) ServerBuilder
+	WithOpenAPI(path string, info OpenAPIInfo) ServerBuilder
+	WithLogger(logger log.ILogger) ServerBuilder
+	Build() (Server, error)
+}
+
+// serverBuilder the HTTP server builder.
+type serverBuilder struct {
+	address           string
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+	drainDelay        time.Duration
+	middlewares       []func(http.Handler) http.Handler
+	livenessPath      string
+	readinessPath     string
+	readinessChecks   []ReadinessCheck
+	accessLog         AccessLogOptions
+	openAPIPath       string
+	openAPIInfo       OpenAPIInfo
+	logger            log.ILogger
+}
+
+// NewServerBuilder creates a new HTTP server builder with default settings.
+func NewServerBuilder() ServerBuilder {
+	builder := &serverBuilder{
+		address:           defaultServerAddress,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		readTimeout:       defaultReadTimeout,
+		writeTimeout:      defaultWriteTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		shutdownTimeout:   defaultShutdownTimeout,
+		drainDelay:        defaultDrainDelay,
+		livenessPath:      defaultLivenessPath,
+		readinessPath:     defaultReadinessPath,
+		logger:            log.DefaultLogger(),
+	}
+
+	return builder
+}
+
+func (builder *serverBuilder) WithAddress(address string) ServerBuilder {
+	builder.address = address
+
+	return builder
+}
+
+func (builder *serverBuilder) WithReadHeaderTimeout(timeout time.Duration) ServerBuilder {
+	builder.readHeaderTimeout = timeout
+
+	return builder
+}
+
+func (builder *serverBuilder) WithReadTimeout(timeout time.Duration) ServerBuilder {
+	builder.readTimeout = timeout
+
+	return builder
+}
+
+func (builder *serverBuilder) WithWriteTimeout(timeout time.Duration) ServerBuilder {
+	builder.writeTimeout = timeout
+
+	return builder
+}
+
+func (builder *serverBuilder) WithIdleTimeout(timeout time.Duration) ServerBuilder {
+	builder.idleTimeout = timeout
+
+	return builder
+}
+
+func (builder *serverBuilder) WithShutdownTimeout(timeout time.Duration) ServerBuilder {
+	builder.shutdownTimeout = timeout
+
+	return builder
+}
+
+// WithDrainDelay sets how long the server keeps serving with a failing readiness probe before shutting down, so load
+// balancers notice it and stop routing new requests to it.
+func (builder *serverBuilder) WithDrainDelay(delay time.Duration) ServerBuilder {
+	builder.drainDelay = delay
+
+	return builder
+}
+
+// WithMiddlewares adds middlewares after the standard stack.
+func (builder *serverBuilder) WithMiddlewares(middlewares ...func(http.Handler) http.Handler) ServerBuilder {
+	builder.middlewares = append(builder.middlewares, middlewares...)
+
+	return builder
+}
+
+func (builder *serverBuilder) WithHealthPaths(livenessPath, readinessPath string) ServerBuilder {
+	builder.livenessPath = livenessPath
+	builder.readinessPath = readinessPath
+
+	return builder
+}
+
+func (builder *serverBuilder) WithReadinessCheck(check ReadinessCheck) ServerBuilder {
+	builder.readinessChecks = append(builder.readinessChecks, check)
+
+	return builder
+}
+
+// WithAccessLog sets the access log options. The health paths are always skipped.
+func (builder *serverBuilder) WithAccessLog(opts AccessLogOptions) ServerBuilder {
+	builder.accessLog = opts
+
+	return builder
+}
+
+// WithOpenAPI serves the OpenAPI document of the router routes at the path.
+func (builder *serverBuilder) WithOpenAPI(path string, info OpenAPIInfo) ServerBuilder {
+	builder.openAPIPath = path
+	builder.openAPIInfo = info
+
+	return builder
+}
+
+func (builder *serverBuilder) WithLogger(logger log.ILogger) ServerBuilder {
+	builder.logger = logger
+
+	return builder
+}
+
+func (builder *serverBuilder) Build() (Server, error) {
+	if builder.address == "" {
+		return nil, voraserror.New(nil, "server address cannot be empty")
+	}
+
+	if builder.readHeaderTimeout <= 0 || builder.readTimeout <= 0 || builder.writeTimeout <= 0 ||
+		builder.idleTimeout <= 0 {
+		return nil, voraserror.New(nil, "server timeouts must be greater than zero")
+	}
+
+	if builder.shutdownTimeout <= 0 {
+		return nil, voraserror.New(nil, "server shutdown timeout must be greater than zero")
+	}
+
+	if builder.drainDelay < 0 {
+		return nil, voraserror.New(nil, "server drain delay cannot be negative")
+	}
+
+	if builder.livenessPath == "" || builder.readinessPath == "" {
+		return nil, voraserror.New(nil, "server health paths cannot be empty")
+	}
+
+	if builder.logger == nil {
+		return nil, voraserror.New(nil, "server logger cannot be nil")
+	}
+
+	accessLog := builder.accessLog
+	accessLog.SkipPaths = append([]string{builder.livenessPath, builder.readinessPath}, accessLog.SkipPaths...)
+
+	router := chi.NewRouter()
+	router.Use(StandardMiddlewares(accessLog)...)
+	router.Use(builder.middlewares...)
+
+	theServer := &server{
+		router:          router,
+		address:         builder.address,
+		shutdownTimeout: builder.shutdownTimeout,
+		drainDelay:      builder.drainDelay,
+		readinessChecks: append([]ReadinessCheck(nil), builder.readinessChecks...),
+		logger:          builder.logger,
+	}
+
+	router.Get(builder.livenessPath, theServer.liveness)
+	router.Get(builder.readinessPath, theServer.readiness)
+
+	if builder.openAPIPath != "" {
+		router.Method(http.MethodGet, builder.openAPIPath, OpenAPIHandler(router, builder.openAPIInfo))
+	}
+
+	theServer.httpServer = &http.Server{
+		Addr:              builder.address,
+		Handler:           router,
+		ReadHeaderTimeout: builder.readHeaderTimeout,
+		ReadTimeout:       builder.readTimeout,
+		WriteTimeout:      builder.writeTimeout,
+		IdleTimeout:       builder.idleTimeout,
+	}
+
+	return theServer, nil
+}
+
+// StandardMiddlewares returns the middleware stack every server applies before the custom ones.
+func StandardMiddlewares(accessLog AccessLogOptions) []func(http.Handler) http.Handler {
+	return []func(http.Handler) http.Handler{
+		middleware.RealIP,
+		RequestID,
+		AccessLog(accessLog),
+		Recoverer,
+	}
+}
+
+type server struct {
+	router          chi.Router
+	httpServer      *http.Server
+	address         string
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	readinessChecks []ReadinessCheck
+	logger          log.ILogger
+	draining        atomic.Bool
+}
+
+func (theServer *server) Router() chi.Router {
+	return theServer.router
+}
+
+func (theServer *server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", theServer.address)
+	if err != nil {
+		return voraserror.New(err, "error listening on "+theServer.address)
+	}
+
+	return theServer.serve(ctx, listener)
+}
+
+func (theServer *server) serve(ctx context.Context, listener net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		theServer.logger.Info(theServer, nil, "Server listening on %s", listener.Addr())
+		serveErr <- theServer.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return voraserror.New(err, "server stopped unexpectedly")
+	case <-ctx.Done():
+	}
+
+	theServer.draining.Store(true)
+	theServer.logger.Info(theServer, nil, "Server draining, failing readiness during %s", theServer.drainDelay)
+
+	select {
+	case err := <-serveErr:
+		return voraserror.New(err, "server stopped unexpectedly")
+	case <-time.After(theServer.drainDelay):
+	}
+
+	theServer.logger.Info(theServer, nil, "Server shutting down, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), theServer.shutdownTimeout)
+	defer cancel()
+
+	if err := theServer.httpServer.Shutdown(shutdownCtx); err != nil {
+		return voraserror.New(err, "error shutting down server")
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return voraserror.New(err, "server stopped unexpectedly")
+	}
+
+	theServer.logger.Info(theServer, nil, "Server stopped")
+
+	return nil
+}
+
+func (theServer *server) liveness(w http.ResponseWriter, _ *http.Request) {
+	_ = EncodeJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
+}
+
+// readiness fails while the server drains so load balancers stop routing new requests to it.
+func (theServer *server) readiness(w http.ResponseWriter, r *http.Request) {
+	if theServer.draining.Load() {
+		_ = EncodeJSON(w, healthResponse{Status: "draining"}, http.StatusServiceUnavailable)
+
+		return
+	}
+
+	for _, check := range theServer.readinessChecks {
+		if err := check(r.Context()); err != nil {
+			_ = EncodeJSON(w, healthResponse{Status: "unavailable", Error: err.Error()}, http.StatusServiceUnavailable)
+
+			return
+		}
+	}
+
+	_ = EncodeJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
+}
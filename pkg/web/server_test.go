@@ -0,0 +1,135 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestServer_HealthEndpoints(t *testing.T) {
+	ready := errors.New("database is not ready")
+
+	server, err := web.NewServerBuilder().
+		WithReadinessCheck(func(ctx context.Context) error { return ready }).
+		Build()
+	assert.Nil(t, err, "Unexpected error building server")
+
+	tests := []struct {
+		name       string
+		path       string
+		ready      error
+		wantStatus int
+	}{
+		{
+			name:       "Liveness is always ok",
+			path:       "/health/live",
+			ready:      errors.New("database is not ready"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Readiness fails when a check fails",
+			path:       "/health/ready",
+			ready:      errors.New("database is not ready"),
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "Readiness is ok when every check passes",
+			path:       "/health/ready",
+			ready:      nil,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready = tt.ready
+			recorder := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+		})
+	}
+}
+
+func TestServer_Run(t *testing.T) {
+	server, err := web.NewServerBuilder().
+		WithAddress("127.0.0.1:0").
+		WithShutdownTimeout(time.Second).
+		WithDrainDelay(0).
+		Build()
+	assert.Nil(t, err, "Unexpected error building server")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err = <-done:
+		assert.Nil(t, err, "Server should stop gracefully")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not stop after the context was cancelled")
+	}
+}
+
+func TestServer_Run_DrainDelay(t *testing.T) {
+	server, err := web.NewServerBuilder().
+		WithAddress("127.0.0.1:0").
+		WithDrainDelay(300 * time.Millisecond).
+		Build()
+	assert.Nil(t, err, "Unexpected error building server")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	readiness := func() int {
+		recorder := httptest.NewRecorder()
+		server.Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, readiness(), "Readiness should be ok before the shutdown")
+
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		return readiness() == http.StatusServiceUnavailable
+	}, time.Second, time.Millisecond, "Readiness should fail while the server drains")
+
+	select {
+	case <-done:
+		t.Fatal("Server should keep running during the drain delay")
+	default:
+	}
+
+	select {
+	case err = <-done:
+		assert.Nil(t, err, "Server should stop gracefully")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not stop after the drain delay")
+	}
+}
+
+func TestServerBuilder_Build(t *testing.T) {
+	_, err := web.NewServerBuilder().WithAddress("").Build()
+
+	assert.NotNil(t, err, "Empty address should be rejected")
+}
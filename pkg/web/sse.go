@@ -0,0 +1,231 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LastEventIDHeader the header browsers send with the ID of the last event received when they reconnect.
+	LastEventIDHeader = "Last-Event-ID"
+
+	defaultHeartbeatInterval = 15 * time.Second
+)
+
+// errStreamClosed is returned when sending events to a closed event stream.
+var errStreamClosed = errors.New("event stream is closed")
+
+// Event a Server-Sent Event. Data is written as is when it is a string or a byte slice and encoded as JSON
+// otherwise. Retry asks the client to wait that long before reconnecting.
+type Event struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// ReplaySource provides the events missed by a client that reconnects.
+type ReplaySource interface {
+	// Replay returns the events sent after the one identified by lastEventID, oldest first.
+	Replay(ctx context.Context, lastEventID string) ([]Event, error)
+}
+
+// SSEOptions the options of an event stream.
+type SSEOptions struct {
+	// HeartbeatInterval the time between the comments keeping idle connections alive through proxies. Zero means
+	// 15 seconds and a negative value disables heartbeats.
+	HeartbeatInterval time.Duration
+	// Retry the reconnection delay suggested to the client when the stream opens. Zero leaves the browser default.
+	Retry time.Duration
+	// Replay resends the missed events when the request has a Last-Event-ID header.
+	Replay ReplaySource
+}
+
+// EventStream a Server-Sent Events stream. It is safe for concurrent use.
+type EventStream struct {
+	ctx         context.Context
+	writer      http.ResponseWriter
+	flusher     http.Flusher
+	lastEventID string
+
+	mutex  sync.Mutex
+	closed bool
+	stop   chan struct{}
+}
+
+// NewEventStream upgrades the response to a Server-Sent Events stream and replays the events missed since the
+// Last-Event-ID of the request, if any. The server write timeout is lifted for the response. The stream stops when
+// the request context is done, watch it with Done. Close it before the handler returns to stop the heartbeats.
+func NewEventStream(w http.ResponseWriter, r *http.Request, opts SSEOptions) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("response writer does not support flushing")
+	}
+
+	// Event streams outlive the server write timeout; writers that cannot lift it keep it.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream.
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &EventStream{
+		ctx:         r.Context(),
+		writer:      w,
+		flusher:     flusher,
+		lastEventID: r.Header.Get(LastEventIDHeader),
+		stop:        make(chan struct{}),
+	}
+
+	if opts.Retry > 0 {
+		if err := stream.write("retry: " + strconv.FormatInt(opts.Retry.Milliseconds(), 10) + "\n\n"); err != nil {
+			return nil, err
+		}
+	} else {
+		stream.mutex.Lock()
+		stream.flusher.Flush()
+		stream.mutex.Unlock()
+	}
+
+	if opts.Replay != nil && stream.lastEventID != "" {
+		events, err := opts.Replay.Replay(stream.ctx, stream.lastEventID)
+		if err != nil {
+			return nil, fmt.Errorf("error replaying events after %s: %w", stream.lastEventID, err)
+		}
+
+		for _, event := range events {
+			if err := stream.Send(event); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	heartbeatInterval := opts.HeartbeatInterval
+	if heartbeatInterval == 0 {
+		heartbeatInterval = defaultHeartbeatInterval
+	}
+
+	if heartbeatInterval > 0 {
+		go stream.heartbeat(heartbeatInterval)
+	}
+
+	return stream, nil
+}
+
+// LastEventID returns the Last-Event-ID the client reconnected with, or an empty string for new clients.
+func (stream *EventStream) LastEventID() string {
+	return stream.lastEventID
+}
+
+// Done returns a channel closed when the client goes away.
+func (stream *EventStream) Done() <-chan struct{} {
+	return stream.ctx.Done()
+}
+
+// Send writes the event and flushes it to the client.
+func (stream *EventStream) Send(event Event) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") || strings.ContainsAny(event.Event, "\r\n") {
+		return fmt.Errorf("event id and name cannot contain line breaks")
+	}
+
+	var data string
+
+	switch value := event.Data.(type) {
+	case nil:
+	case string:
+		data = value
+	case []byte:
+		data = string(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		data = string(encoded)
+	}
+
+	builder := strings.Builder{}
+
+	if event.ID != "" {
+		builder.WriteString("id: " + event.ID + "\n")
+	}
+
+	if event.Event != "" {
+		builder.WriteString("event: " + event.Event + "\n")
+	}
+
+	if event.Retry > 0 {
+		builder.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	// Every line of the data needs its own field.
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		builder.WriteString("data: " + line + "\n")
+	}
+
+	builder.WriteString("\n")
+
+	return stream.write(builder.String())
+}
+
+// Close stops the heartbeats. Events can no longer be sent after closing the stream.
+func (stream *EventStream) Close() {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if !stream.closed {
+		stream.closed = true
+		close(stream.stop)
+	}
+}
+
+func (stream *EventStream) write(message string) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.closed {
+		return errStreamClosed
+	}
+
+	if err := stream.ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := stream.writer.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	stream.flusher.Flush()
+
+	return nil
+}
+
+func (stream *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stream.stop:
+			return
+		case <-stream.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := stream.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
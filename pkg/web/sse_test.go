@@ -0,0 +1,71 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type replaySourceFunc func(ctx context.Context, lastEventID string) ([]web.Event, error)
+
+func (fn replaySourceFunc) Replay(ctx context.Context, lastEventID string) ([]web.Event, error) {
+	return fn(ctx, lastEventID)
+}
+
+func TestEventStream(t *testing.T) {
+	replay := replaySourceFunc(func(ctx context.Context, lastEventID string) ([]web.Event, error) {
+		assert.Equal(t, "41", lastEventID, "Last event ID is not the expected")
+
+		return []web.Event{{ID: "42", Event: "progress", Data: "missed"}}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs/1/events", nil)
+	req.Header.Set(web.LastEventIDHeader, "41")
+	recorder := httptest.NewRecorder()
+
+	stream, err := web.NewEventStream(recorder, req, web.SSEOptions{
+		HeartbeatInterval: 10 * time.Millisecond,
+		Retry:             3 * time.Second,
+		Replay:            replay,
+	})
+	assert.Nil(t, err, "Stream should open")
+
+	assert.Nil(t, stream.Send(web.Event{ID: "43", Event: "progress", Data: map[string]int{"percent": 50}}),
+		"Event should be sent")
+	assert.Nil(t, stream.Send(web.Event{Data: "line 1\nline 2"}), "Event should be sent")
+
+	time.Sleep(30 * time.Millisecond)
+	stream.Close()
+
+	assert.ErrorContains(t, stream.Send(web.Event{Data: "late"}), "closed", "Closed streams should not send events")
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"), "Content type is not the expected")
+
+	body := recorder.Body.String()
+	assert.True(t, strings.HasPrefix(body, "retry: 3000\n\n"+
+		"id: 42\nevent: progress\ndata: missed\n\n"+
+		"id: 43\nevent: progress\ndata: {\"percent\":50}\n\n"+
+		"data: line 1\ndata: line 2\n\n"), "Body is not the expected: %s", body)
+	assert.Contains(t, body, ": heartbeat\n\n", "Heartbeats should be sent")
+}
+
+func TestEventStreamContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/jobs/1/events", nil).WithContext(ctx)
+
+	stream, err := web.NewEventStream(httptest.NewRecorder(), req, web.SSEOptions{HeartbeatInterval: -1})
+	assert.Nil(t, err, "Stream should open")
+
+	defer stream.Close()
+
+	cancel()
+
+	<-stream.Done()
+	assert.ErrorIs(t, stream.Send(web.Event{Data: "gone"}), context.Canceled, "Sending should stop with the request")
+}
@@ -0,0 +1,338 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultStreamFlushEvery    = 100
+	defaultStreamFlushInterval = time.Second
+	streamBufferSize           = 32 * 1024
+)
+
+// StreamFormat the format of a streamed response.
+type StreamFormat int
+
+const (
+	// StreamJSONArray streams the elements as a single JSON array.
+	StreamJSONArray StreamFormat = iota
+	// StreamNDJSON streams the elements as newline delimited JSON, one element per line.
+	StreamNDJSON
+)
+
+// StreamOptions the options of StreamJSON.
+type StreamOptions struct {
+	Format StreamFormat
+	// FlushEvery the number of elements written between flushes. Zero means 100.
+	FlushEvery int
+	// FlushInterval the maximum time the written elements wait to be flushed, even while the iterator blocks, so slow
+	// iterators still reach the client. Zero means a second.
+	FlushInterval time.Duration
+}
+
+// Iterator iterates over the elements of a streamed response.
+type Iterator[T any] interface {
+	// Next advances to the next element, returning false when there are no more elements or an error happened.
+	Next() bool
+	// Value returns the current element.
+	Value() (T, error)
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+	// Close releases the resources of the iterator.
+	Close() error
+}
+
+type rowsIterator[T any] struct {
+	rows       *sqlx.Rows
+	structScan bool
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// RowsIterator iterates over rows returned by database.Client's Queryx, scanning structs by their db tags and
+// scalars by position. Like sqlx, structs implementing sql.Scanner or without mapped fields, such as sql.NullString
+// or time.Time, are scanned as scalars.
+func RowsIterator[T any](rows *sqlx.Rows) Iterator[T] {
+	valueType := reflect.TypeOf((*T)(nil)).Elem()
+
+	structScan := valueType.Kind() == reflect.Struct && !reflect.PointerTo(valueType).Implements(scannerType) &&
+		len(rows.Mapper.TypeMap(valueType).Index) > 0
+
+	return &rowsIterator[T]{rows: rows, structScan: structScan}
+}
+
+func (iterator *rowsIterator[T]) Next() bool {
+	return iterator.rows.Next()
+}
+
+func (iterator *rowsIterator[T]) Value() (T, error) {
+	var value T
+
+	if iterator.structScan {
+		return value, iterator.rows.StructScan(&value)
+	}
+
+	return value, iterator.rows.Scan(&value)
+}
+
+func (iterator *rowsIterator[T]) Err() error {
+	return iterator.rows.Err()
+}
+
+func (iterator *rowsIterator[T]) Close() error {
+	return iterator.rows.Close()
+}
+
+type channelIterator[T any] struct {
+	ctx     context.Context
+	values  <-chan T
+	current T
+	err     error
+}
+
+// ChannelIterator iterates over the values received from the channel until it is closed or the context is done.
+func ChannelIterator[T any](ctx context.Context, values <-chan T) Iterator[T] {
+	return &channelIterator[T]{ctx: ctx, values: values}
+}
+
+func (iterator *channelIterator[T]) Next() bool {
+	select {
+	case <-iterator.ctx.Done():
+		iterator.err = iterator.ctx.Err()
+
+		return false
+	case value, ok := <-iterator.values:
+		iterator.current = value
+
+		return ok
+	}
+}
+
+func (iterator *channelIterator[T]) Value() (T, error) {
+	return iterator.current, nil
+}
+
+func (iterator *channelIterator[T]) Err() error {
+	return iterator.err
+}
+
+func (iterator *channelIterator[T]) Close() error {
+	return nil
+}
+
+// StreamJSON writes the elements of the iterator to the response one by one, as a JSON array or as NDJSON, so memory
+// use does not grow with the number of elements. The response is flushed every FlushEvery elements and at least
+// every FlushInterval. The stream lifts the server write timeout, since long exports would be cut off by it. The
+// iterator is closed and the iteration stops when the client goes away.
+// Errors happening before the first element is written are answered with EncodeError. Later errors can no longer
+// change the status, so they truncate the response, which leaves JSON arrays unterminated for clients to notice.
+// The error is returned in both cases so the caller can log it.
+func StreamJSON[T any](w http.ResponseWriter, r *http.Request, iterator Iterator[T], opts StreamOptions) error {
+	defer iterator.Close()
+
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = defaultStreamFlushEvery
+	}
+
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultStreamFlushInterval
+	}
+
+	stream := &jsonStream{
+		writer:        w,
+		buffer:        bufio.NewWriterSize(w, streamBufferSize),
+		ndjson:        opts.Format == StreamNDJSON,
+		flushEvery:    opts.FlushEvery,
+		flushInterval: opts.FlushInterval,
+		stop:          make(chan struct{}),
+	}
+
+	defer stream.stopFlusher()
+
+	ctx := r.Context()
+
+	for iterator.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		value, err := iterator.Value()
+		if err == nil {
+			err = stream.write(value)
+		}
+
+		if err != nil {
+			return stream.fail(err)
+		}
+	}
+
+	if err := iterator.Err(); err != nil {
+		return stream.fail(err)
+	}
+
+	return stream.end()
+}
+
+// jsonStream writes the elements of StreamJSON.
+type jsonStream struct {
+	writer        http.ResponseWriter
+	buffer        *bufio.Writer
+	ndjson        bool
+	flushEvery    int
+	flushInterval time.Duration
+
+	// mutex guards the writes, shared with the periodic flusher.
+	mutex   sync.Mutex
+	count   int
+	pending int
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// start writes the status and starts flushing periodically. The mutex must be held.
+func (stream *jsonStream) start() {
+	if stream.ndjson {
+		stream.writer.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		stream.writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	// Streams outlive the server write timeout; writers that cannot lift it keep it.
+	_ = http.NewResponseController(stream.writer).SetWriteDeadline(time.Time{})
+
+	stream.writer.WriteHeader(http.StatusOK)
+
+	stream.stopped = make(chan struct{})
+
+	go stream.flushPeriodically()
+}
+
+// flushPeriodically flushes the pending elements every flush interval, so they reach the client while the iterator
+// blocks waiting for the next one.
+func (stream *jsonStream) flushPeriodically() {
+	defer close(stream.stopped)
+
+	ticker := time.NewTicker(stream.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stream.stop:
+			return
+		case <-ticker.C:
+			stream.mutex.Lock()
+
+			if stream.pending > 0 {
+				// A failed flush leaves the error in the buffer, the next flush reports it.
+				_ = stream.flush()
+			}
+
+			stream.mutex.Unlock()
+		}
+	}
+}
+
+// stopFlusher stops the periodic flushes, waiting for the running one so nothing writes after the handler returns.
+func (stream *jsonStream) stopFlusher() {
+	close(stream.stop)
+
+	stream.mutex.Lock()
+	stopped := stream.stopped
+	stream.mutex.Unlock()
+
+	if stopped != nil {
+		<-stopped
+	}
+}
+
+func (stream *jsonStream) write(value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.count == 0 {
+		stream.start()
+
+		if !stream.ndjson {
+			_ = stream.buffer.WriteByte('[')
+		}
+	} else if !stream.ndjson {
+		_ = stream.buffer.WriteByte(',')
+	}
+
+	_, _ = stream.buffer.Write(encoded)
+
+	if stream.ndjson {
+		_ = stream.buffer.WriteByte('\n')
+	}
+
+	stream.count++
+	stream.pending++
+
+	if stream.pending >= stream.flushEvery {
+		return stream.flush()
+	}
+
+	// bufio.Writer keeps the first write error, the next flush reports it.
+	return nil
+}
+
+// flush writes the buffered elements to the client. The mutex must be held.
+func (stream *jsonStream) flush() error {
+	stream.pending = 0
+
+	if err := stream.buffer.Flush(); err != nil {
+		return err
+	}
+
+	if flusher, ok := stream.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+func (stream *jsonStream) end() error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.count == 0 {
+		stream.start()
+
+		if !stream.ndjson {
+			_, _ = stream.buffer.WriteString("[]")
+		}
+	} else if !stream.ndjson {
+		_ = stream.buffer.WriteByte(']')
+	}
+
+	return stream.buffer.Flush()
+}
+
+func (stream *jsonStream) fail(err error) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.count == 0 {
+		_ = EncodeError(stream.writer, err)
+
+		return err
+	}
+
+	_ = stream.buffer.Flush()
+
+	return err
+}
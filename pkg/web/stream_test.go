@@ -0,0 +1,308 @@
+package web_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+type streamedOrder struct {
+	ID int `json:"id"`
+}
+
+// failingIterator yields the given number of orders and then fails.
+type failingIterator struct {
+	remaining int
+	current   int
+	err       error
+}
+
+func (iterator *failingIterator) Next() bool {
+	if iterator.remaining == 0 {
+		return false
+	}
+
+	iterator.remaining--
+	iterator.current++
+
+	return true
+}
+
+func (iterator *failingIterator) Value() (streamedOrder, error) {
+	return streamedOrder{ID: iterator.current}, nil
+}
+
+func (iterator *failingIterator) Err() error {
+	return iterator.err
+}
+
+func (iterator *failingIterator) Close() error {
+	return nil
+}
+
+func TestStreamJSON(t *testing.T) {
+	queryErr := errors.New("connection reset")
+
+	tests := []struct {
+		name            string
+		orders          []streamedOrder
+		iterator        web.Iterator[streamedOrder]
+		opts            web.StreamOptions
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantErr         error
+	}{
+		{
+			name:            "JSON array",
+			orders:          []streamedOrder{{ID: 1}, {ID: 2}, {ID: 3}},
+			opts:            web.StreamOptions{FlushEvery: 2},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `[{"id":1},{"id":2},{"id":3}]`,
+		},
+		{
+			name:            "Empty JSON array",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `[]`,
+		},
+		{
+			name:            "NDJSON",
+			orders:          []streamedOrder{{ID: 1}, {ID: 2}},
+			opts:            web.StreamOptions{Format: web.StreamNDJSON},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson; charset=utf-8",
+			wantBody:        "{\"id\":1}\n{\"id\":2}\n",
+		},
+		{
+			name:            "Error before the first element",
+			iterator:        &failingIterator{err: queryErr},
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"status":500,"message":"Internal Server Error"}`,
+			wantErr:         queryErr,
+		},
+		{
+			name:            "Error after the first element",
+			iterator:        &failingIterator{remaining: 2, err: queryErr},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `[{"id":1},{"id":2}`,
+			wantErr:         queryErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders/export", nil)
+
+			iterator := tt.iterator
+			if iterator == nil {
+				orders := make(chan streamedOrder, len(tt.orders))
+				for _, order := range tt.orders {
+					orders <- order
+				}
+
+				close(orders)
+
+				iterator = web.ChannelIterator[streamedOrder](context.Background(), orders)
+			}
+
+			recorder := httptest.NewRecorder()
+			err := web.StreamJSON(recorder, req, iterator, tt.opts)
+
+			assert.ErrorIs(t, err, tt.wantErr, "Error is not the expected")
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+			assert.Equal(t, tt.wantContentType, recorder.Header().Get("Content-Type"),
+				"Content type is not the expected")
+			assert.Equal(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+		})
+	}
+}
+
+func TestStreamJSONClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/orders/export", nil).WithContext(ctx)
+
+	orders := make(chan streamedOrder)
+	go func() {
+		orders <- streamedOrder{ID: 1}
+		cancel()
+	}()
+
+	err := web.StreamJSON(httptest.NewRecorder(), req, web.ChannelIterator[streamedOrder](ctx, orders),
+		web.StreamOptions{})
+
+	assert.ErrorIs(t, err, context.Canceled, "Streaming should stop when the client goes away")
+}
+
+func TestStreamJSONSlowIterator(t *testing.T) {
+	orders := make(chan streamedOrder)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = web.StreamJSON(w, r, web.ChannelIterator[streamedOrder](r.Context(), orders), web.StreamOptions{
+			Format:        web.StreamNDJSON,
+			FlushInterval: 10 * time.Millisecond,
+		})
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+
+	defer server.Close()
+
+	// The response headers are sent along with the first order.
+	go func() {
+		orders <- streamedOrder{ID: 1}
+	}()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err, "Unexpected error requesting the stream")
+
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+
+	for id := 1; id <= 2; id++ {
+		if id > 1 {
+			orders <- streamedOrder{ID: id}
+		}
+
+		// The iterator blocks after each order, so only the periodic flush sends it.
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err, "Order should be flushed while the iterator blocks")
+		assert.JSONEq(t, fmt.Sprintf(`{"id":%d}`, id), line, "Order is not the expected")
+
+		// Outlives the server write timeout.
+		time.Sleep(150 * time.Millisecond)
+	}
+
+	close(orders)
+
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF, "Stream should end once the iterator is done")
+}
+
+// staticRows a database/sql connector answering every query with the same columns and values.
+type staticRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (rows staticRows) Connect(context.Context) (driver.Conn, error) {
+	return staticConn{rows: rows}, nil
+}
+
+func (rows staticRows) Driver() driver.Driver {
+	return nil
+}
+
+// query runs a query on the rows, returning them as sqlx rows.
+func (rows staticRows) query(t *testing.T) *sqlx.Rows {
+	db := sqlx.NewDb(sql.OpenDB(rows), "mysql")
+	t.Cleanup(func() { _ = db.Close() })
+
+	result, err := db.Queryx("SELECT * FROM orders")
+	assert.Nil(t, err, "Unexpected error querying rows")
+
+	return result
+}
+
+type staticConn struct {
+	rows staticRows
+}
+
+func (conn staticConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (conn staticConn) Close() error {
+	return nil
+}
+
+func (conn staticConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (conn staticConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &staticCursor{rows: conn.rows}, nil
+}
+
+type staticCursor struct {
+	rows staticRows
+	next int
+}
+
+func (cursor *staticCursor) Columns() []string {
+	return cursor.rows.columns
+}
+
+func (cursor *staticCursor) Close() error {
+	return nil
+}
+
+func (cursor *staticCursor) Next(dest []driver.Value) error {
+	if cursor.next == len(cursor.rows.values) {
+		return io.EOF
+	}
+
+	copy(dest, cursor.rows.values[cursor.next])
+	cursor.next++
+
+	return nil
+}
+
+// collect reads every value of the iterator.
+func collect[T any](t *testing.T, iterator web.Iterator[T]) []T {
+	defer iterator.Close()
+
+	values := []T{}
+
+	for iterator.Next() {
+		value, err := iterator.Value()
+		assert.Nil(t, err, "Unexpected error scanning row")
+
+		values = append(values, value)
+	}
+
+	assert.Nil(t, iterator.Err(), "Unexpected error iterating rows")
+
+	return values
+}
+
+func TestRowsIterator(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	type order struct {
+		ID     int            `db:"id"`
+		Coupon sql.NullString `db:"coupon"`
+	}
+
+	orders := staticRows{
+		columns: []string{"id", "coupon"},
+		values:  [][]driver.Value{{int64(1), "SPRING"}, {int64(2), nil}},
+	}
+	assert.Equal(t, []order{{ID: 1, Coupon: sql.NullString{String: "SPRING", Valid: true}}, {ID: 2}},
+		collect(t, web.RowsIterator[order](orders.query(t))), "Structs should be scanned by their db tags")
+
+	coupons := staticRows{columns: []string{"coupon"}, values: [][]driver.Value{{"SPRING"}, {nil}}}
+	assert.Equal(t, []sql.NullString{{String: "SPRING", Valid: true}, {}},
+		collect(t, web.RowsIterator[sql.NullString](coupons.query(t))), "Nullable columns should be scanned")
+
+	dates := staticRows{columns: []string{"created_at"}, values: [][]driver.Value{{createdAt}}}
+	assert.Equal(t, []time.Time{createdAt}, collect(t, web.RowsIterator[time.Time](dates.query(t))),
+		"Time columns should be scanned")
+}
@@ -0,0 +1,17 @@
+package web
+
+import "context"
+
+type subjectContextKey struct{}
+
+// WithSubject returns a copy of the context carrying the authenticated subject of the request.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectContextKey{}, subject)
+}
+
+// SubjectFromContext returns the authenticated subject of the request or an empty string for anonymous requests.
+func SubjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectContextKey{}).(string)
+
+	return subject
+}
@@ -0,0 +1,239 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adminvoras/commons-lib/pkg/log"
+)
+
+// RequestTimeoutHeader the header carrying the time budget left to the caller, in milliseconds.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// RemainingBudget returns the time left until the deadline of the context, to size the timeouts of downstream
+// calls, such as database queries, that do not take a context. It returns false if the context has no deadline.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	return time.Until(deadline), true
+}
+
+// Timeout returns a middleware bounding the request context with the timeout, shrunk to the budget of the caller
+// when the request has an X-Request-Timeout header. Requests arriving with an exhausted budget get a JSON 503
+// without running the handler. If the deadline elapses before the handler writes the response, the client gets a
+// JSON 504 and the later writes of the handler fail with http.ErrHandlerTimeout. The handler keeps running in the
+// background after the 504, so handlers should stop when the context is done. Long lived responses, such as
+// StreamJSON or Server-Sent Events, outlive any timeout and must be routed outside of it.
+// It panics if the timeout is not greater than zero.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	if timeout <= 0 {
+		panic("web: timeout must be greater than zero")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget := timeout
+
+			if header := r.Header.Get(RequestTimeoutHeader); header != "" {
+				if milliseconds, err := strconv.ParseInt(header, 10, 64); err == nil {
+					if milliseconds <= 0 {
+						_ = EncodeError(w, &RequestError{
+							Status:  http.StatusServiceUnavailable,
+							Message: "request deadline exceeded before processing",
+						})
+
+						return
+					}
+
+					// Compared before converting, since huge budgets would overflow the duration.
+					if milliseconds < budget.Milliseconds() {
+						budget = time.Duration(milliseconds) * time.Millisecond
+					}
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+
+			serveWithTimeout(ctx, next, w, r.WithContext(ctx))
+		})
+	}
+}
+
+// serveWithTimeout runs the handler in its own goroutine so the deadline can be answered even if the handler ignores
+// the context. Panics are re-raised in the serving goroutine for Recoverer, or logged when they happen after the
+// timeout response, since nothing is waiting for them anymore. When the client goes away, it waits for the handler so
+// graceful shutdowns still account for it.
+func serveWithTimeout(ctx context.Context, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	writer := &timeoutWriter{writer: w, header: w.Header().Clone()}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				writer.mutex.Lock()
+				defer writer.mutex.Unlock()
+
+				if writer.timedOut {
+					log.FromContext(r.Context()).Error(writer, map[string]string{"stack": string(debug.Stack())},
+						fmt.Errorf("%v", recovered), "Panic after the request timed out serving %s %s", r.Method,
+						r.URL.Path)
+
+					return
+				}
+
+				panicked <- recovered
+
+				return
+			}
+
+			close(done)
+		}()
+
+		next.ServeHTTP(writer, r)
+	}()
+
+	wait := func() {
+		select {
+		case recovered := <-panicked:
+			panic(recovered)
+		case <-done:
+		}
+	}
+
+	select {
+	case recovered := <-panicked:
+		panic(recovered)
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	// Clients that went away get no response.
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		wait()
+
+		return
+	}
+
+	writer.mutex.Lock()
+
+	if writer.wroteHeader {
+		// The response started, it can only be completed by the handler.
+		writer.mutex.Unlock()
+		wait()
+
+		return
+	}
+
+	writer.timedOut = true
+
+	// A panic sent before the timeout was marked is still re-raised, later ones are logged by the handler goroutine.
+	select {
+	case recovered := <-panicked:
+		writer.mutex.Unlock()
+		panic(recovered)
+	default:
+	}
+
+	writer.mutex.Unlock()
+
+	_ = EncodeError(w, &RequestError{Status: http.StatusGatewayTimeout, Message: "request timed out"})
+}
+
+// timeoutWriter forwards the response to the client until the deadline answered it. The handler writes its headers
+// to a copy, so it cannot race with the timeout response.
+type timeoutWriter struct {
+	writer http.ResponseWriter
+	header http.Header
+
+	mutex       sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController can lift its deadlines.
+func (writer *timeoutWriter) Unwrap() http.ResponseWriter {
+	return writer.writer
+}
+
+func (writer *timeoutWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *timeoutWriter) WriteHeader(status int) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.writeHeader(status)
+}
+
+// writeHeader copies the headers and sends the status. The mutex must be held.
+func (writer *timeoutWriter) writeHeader(status int) {
+	if writer.timedOut || writer.wroteHeader {
+		return
+	}
+
+	writer.wroteHeader = true
+
+	header := writer.writer.Header()
+	for name := range header {
+		if _, ok := writer.header[name]; !ok {
+			delete(header, name)
+		}
+	}
+
+	for name, values := range writer.header {
+		header[name] = values
+	}
+
+	writer.writer.WriteHeader(status)
+}
+
+func (writer *timeoutWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	writer.writeHeader(http.StatusOK)
+
+	return writer.writer.Write(data)
+}
+
+func (writer *timeoutWriter) Flush() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.timedOut {
+		return
+	}
+
+	writer.writeHeader(http.StatusOK)
+
+	if flusher, ok := writer.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requestTimeoutHeaderValue returns the X-Request-Timeout header value of the context deadline.
+func requestTimeoutHeaderValue(ctx context.Context) (string, bool) {
+	remaining, ok := RemainingBudget(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return strconv.FormatInt(max(remaining.Milliseconds(), 0), 10), true
+}
@@ -0,0 +1,217 @@
+package web_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/utils/logger"
+	"github.com/adminvoras/commons-lib/pkg/web"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestBudget string
+		handler       http.HandlerFunc
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name: "Handler in time",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				budget, ok := web.RemainingBudget(r.Context())
+				assert.True(t, ok, "Context should have a deadline")
+				assert.LessOrEqual(t, budget, 50*time.Millisecond, "Budget should be bounded by the timeout")
+
+				w.Header().Set("X-Order", "1")
+				w.WriteHeader(http.StatusCreated)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:          "Budget shrunk by the caller",
+			requestBudget: "10",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   `{"status":504,"message":"request timed out"}`,
+		},
+		{
+			name:          "Budget of the caller beyond the timeout",
+			requestBudget: "9223372036854775807",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				budget, _ := web.RemainingBudget(r.Context())
+				assert.Greater(t, budget, 40*time.Millisecond, "Budget should be clamped to the timeout")
+
+				w.WriteHeader(http.StatusOK)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "Budget exhausted on arrival",
+			requestBudget: "0",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Handler should not run")
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":503,"message":"request deadline exceeded before processing"}`,
+		},
+		{
+			name: "Handler ignoring the context",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+
+				_, err := w.Write([]byte("late"))
+				assert.ErrorIs(t, err, http.ErrHandlerTimeout, "Late writes should fail")
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   `{"status":504,"message":"request timed out"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.requestBudget != "" {
+				req.Header.Set(web.RequestTimeoutHeader, tt.requestBudget)
+			}
+
+			recorder := httptest.NewRecorder()
+			start := time.Now()
+			web.Timeout(50*time.Millisecond)(tt.handler).ServeHTTP(recorder, req)
+
+			assert.Less(t, time.Since(start), 90*time.Millisecond, "Response should not wait for the handler")
+			assert.Equal(t, tt.wantStatus, recorder.Code, "Status is not the expected")
+
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, recorder.Body.String(), "Body is not the expected")
+			}
+		})
+	}
+
+	// Let the handler ignoring the context finish its assertions.
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	handler := web.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	}, "Panics should reach the serving goroutine")
+}
+
+func TestTimeoutPanicAfterDeadline(t *testing.T) {
+	output := &syncBuffer{}
+	logger.SetLogLevel("debug")
+	logger.Log.Out = output
+
+	defer func() {
+		logger.Log.Out = os.Stdout
+	}()
+
+	handler := web.Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		panic("late boom")
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code, "Status is not the expected")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(output.String(), "late boom")
+	}, time.Second, 5*time.Millisecond, "Panic after the timeout should be logged")
+}
+
+func TestTimeoutClientGone(t *testing.T) {
+	var finished atomic.Bool
+
+	handler := web.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx))
+
+	assert.True(t, finished.Load(), "Middleware should wait for the handler when the client goes away")
+	assert.Empty(t, recorder.Body.String(), "Clients that went away should get no response")
+}
+
+func TestTimeoutResponseController(t *testing.T) {
+	server := httptest.NewServer(web.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		assert.Nil(t, err, "Write deadline should be lifted through the timeout writer")
+
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err, "Unexpected error requesting the server")
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Status is not the expected")
+}
+
+// syncBuffer a buffer safe to read while the logger writes to it from other goroutines.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(data []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	return buffer.buffer.Write(data)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	return buffer.buffer.String()
+}
+
+func TestClientPropagatesTimeout(t *testing.T) {
+	var received string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(web.RequestTimeoutHeader)
+	}))
+	defer server.Close()
+
+	client, err := web.NewClientBuilder().WithBaseURL(server.URL).Build()
+	assert.Nil(t, err, "Client should be built")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	assert.Nil(t, client.Get(ctx, "/orders", nil), "Request should succeed")
+
+	budget, err := strconv.Atoi(received)
+	assert.Nil(t, err, "Timeout header should be propagated")
+	assert.InDelta(t, 2000, budget, 100, "Timeout header is not the expected")
+}
@@ -0,0 +1,329 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const validateTag = "validate"
+
+var regexpCache sync.Map
+
+// FieldError describes a field breaking one of its validation rules.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field breaking its validation rules.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, len(err.Fields))
+	for i, field := range err.Fields {
+		messages[i] = field.Message
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (err *ValidationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Validate checks the rules declared in the validate struct tags of v, which must be a struct or a pointer to one.
+// Nested structs and slices of structs are validated too, and fields are named after their json tag.
+//
+// The supported rules are required, min=n, max=n, len=n, enum=a|b|c, email and regex=expr. For strings, slices and
+// maps min, max and len apply to the length, for numbers to the value. The regex rule must be the last one of the
+// tag since the expression may contain commas.
+//
+// It returns a *ValidationError when at least one rule is broken and a plain error if a tag is malformed.
+func Validate(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+
+		value = value.Elem()
+	}
+
+	var fields []FieldError
+
+	if err := validateValue(value, "", &fields); err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+func validateValue(value reflect.Value, path string, fields *[]FieldError) error {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return validateValue(value.Elem(), path, fields)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), fields); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return validateStruct(value, path, fields)
+	}
+
+	return nil
+}
+
+func validateStruct(value reflect.Value, path string, fields *[]FieldError) error {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldPath := name
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldPath = path
+		} else if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		fieldValue := value.Field(i)
+
+		if tag, ok := field.Tag.Lookup(validateTag); ok {
+			broken, err := checkRules(fieldValue, tag)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", fieldPath, err)
+			}
+
+			if broken != nil {
+				broken.Field = fieldPath
+				broken.Message = fieldPath + " " + broken.Message
+				*fields = append(*fields, *broken)
+
+				continue
+			}
+		}
+
+		if err := validateValue(fieldValue, fieldPath, fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkRules returns the first rule of the tag broken by the value.
+func checkRules(value reflect.Value, tag string) (*FieldError, error) {
+	rules := splitRules(tag)
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			if hasRule(rules, "required") {
+				return &FieldError{Rule: "required", Message: "is required"}, nil
+			}
+
+			return nil, nil
+		}
+
+		value = value.Elem()
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		broken, err := checkRule(value, name, arg)
+		if err != nil || broken != nil {
+			return broken, err
+		}
+	}
+
+	return nil, nil
+}
+
+// splitRules splits the tag by commas keeping the regex rule, which must be the last one, untouched.
+func splitRules(tag string) []string {
+	var rules []string
+
+	for tag != "" {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(rules, tag)
+		}
+
+		rule, rest, _ := strings.Cut(tag, ",")
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+
+		tag = rest
+	}
+
+	return rules
+}
+
+func hasRule(rules []string, name string) bool {
+	for _, rule := range rules {
+		if rule == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkRule(value reflect.Value, name, arg string) (*FieldError, error) {
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return &FieldError{Rule: name, Message: "is required"}, nil
+		}
+	case "min", "max", "len":
+		return checkBound(value, name, arg)
+	case "enum":
+		if value.Kind() == reflect.String && value.Len() == 0 {
+			return nil, nil
+		}
+
+		allowed := strings.Split(arg, "|")
+		actual := fmt.Sprint(value.Interface())
+
+		for _, option := range allowed {
+			if actual == option {
+				return nil, nil
+			}
+		}
+
+		return &FieldError{Rule: name, Message: "must be one of " + strings.Join(allowed, ", ")}, nil
+	case "email":
+		if value.Kind() != reflect.String {
+			return nil, fmt.Errorf("rule email only applies to strings")
+		}
+
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		address, err := mail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return &FieldError{Rule: name, Message: "must be a valid email address"}, nil
+		}
+	case "regex":
+		if value.Kind() != reflect.String {
+			return nil, fmt.Errorf("rule regex only applies to strings")
+		}
+
+		expression, err := compileRegexp(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if value.Len() > 0 && !expression.MatchString(value.String()) {
+			return &FieldError{Rule: name, Message: "must match " + arg}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown validation rule %q", name)
+	}
+
+	return nil, nil
+}
+
+func checkBound(value reflect.Value, name, arg string) (*FieldError, error) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s requires a numeric argument: %w", name, err)
+	}
+
+	var (
+		actual float64
+		length bool
+	)
+
+	switch value.Kind() {
+	case reflect.String:
+		actual, length = float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual, length = float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	default:
+		return nil, fmt.Errorf("rule %s does not apply to %s", name, value.Kind())
+	}
+
+	if name == "len" && !length {
+		return nil, fmt.Errorf("rule len does not apply to %s", value.Kind())
+	}
+
+	unit := ""
+	if length {
+		unit = " characters"
+		if value.Kind() != reflect.String {
+			unit = " items"
+		}
+	}
+
+	switch {
+	case name == "min" && actual < limit:
+		return &FieldError{Rule: name, Message: fmt.Sprintf("must be at least %s%s", arg, unit)}, nil
+	case name == "max" && actual > limit:
+		return &FieldError{Rule: name, Message: fmt.Sprintf("must be at most %s%s", arg, unit)}, nil
+	case name == "len" && actual != limit:
+		return &FieldError{Rule: name, Message: fmt.Sprintf("must have exactly %s%s", arg, unit)}, nil
+	}
+
+	return nil, nil
+}
+
+func compileRegexp(expression string) (*regexp.Regexp, error) {
+	if cached, ok := regexpCache.Load(expression); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("rule regex is not valid: %w", err)
+	}
+
+	regexpCache.Store(expression, compiled)
+
+	return compiled, nil
+}
+
+// fieldName returns the name of the field in its JSON representation.
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
@@ -1,23 +1,16 @@
 package web
 
 import (
-"encoding/json"
-"io"
-
-"net/http"
+	"encoding/json"
+	"io"
+	"net/http"
 )
 
 // EncodeJSON serializes the response as a JSON object to the ResponseWriter.
 // Many JSON-over-HTTP services can use it as a sensible default.
 // If the response implements Headerer, the provided headers will be applied to the response.
 func EncodeJSON(w http.ResponseWriter, v interface{}, code int) error {
-	if headerer, ok := v.(Headerer); ok {
-		for k, values := range headerer.Headers() {
-			for _, v := range values {
-				w.Header().Add(k, v)
-			}
-		}
-	}
+	applyHeaders(w, v)
 
 	// According to https://tools.ietf.org/search/rfc2616#section-7.2.1:
 	//
@@ -30,18 +23,7 @@ func EncodeJSON(w http.ResponseWriter, v interface{}, code int) error {
 		return nil
 	}
 
-	var jsonData []byte
-
-	var err error
-	switch v := v.(type) {
-	case []byte:
-		jsonData = v
-	case io.Reader:
-		jsonData, err = io.ReadAll(v)
-	default:
-		jsonData, err = json.Marshal(v)
-	}
-
+	jsonData, err := marshalJSON(v)
 	if err != nil {
 		return err
 	}
@@ -60,6 +42,29 @@ func EncodeJSON(w http.ResponseWriter, v interface{}, code int) error {
 	return nil
 }
 
+// marshalJSON encodes v as JSON. Byte slices and readers are considered already encoded.
+func marshalJSON(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case io.Reader:
+		return io.ReadAll(v)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// applyHeaders adds the headers of the response if it implements Headerer.
+func applyHeaders(w http.ResponseWriter, v interface{}) {
+	if headerer, ok := v.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+}
+
 type Headerer interface {
 	Headers() http.Header
-}
\ No newline at end of file
+}
@@ -0,0 +1,354 @@
+// Package webtest provides helpers to test HTTP handlers and chi routers: a request builder, fluent response
+// assertions and golden files.
+package webtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// UpdateGoldenEnv the environment variable that, set to true, rewrites the golden files instead of comparing them.
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// Request a request under construction.
+type Request struct {
+	t         testing.TB
+	method    string
+	path      string
+	body      io.Reader
+	header    http.Header
+	query     url.Values
+	urlParams map[string]string
+	ctx       context.Context
+}
+
+// NewRequest starts building a request. The path may contain chi placeholders such as /users/{id}, filled with the
+// URL params.
+func NewRequest(t testing.TB, method, path string) *Request {
+	return &Request{
+		t:         t,
+		method:    method,
+		path:      path,
+		header:    http.Header{},
+		query:     url.Values{},
+		urlParams: map[string]string{},
+		ctx:       context.Background(),
+	}
+}
+
+// WithJSON encodes the body as JSON and sets the Content-Type header. Strings and byte slices are sent as they are.
+func (request *Request) WithJSON(body interface{}) *Request {
+	request.t.Helper()
+
+	switch body := body.(type) {
+	case string:
+		request.body = strings.NewReader(body)
+	case []byte:
+		request.body = bytes.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			request.t.Fatalf("error encoding request body: %v", err)
+		}
+
+		request.body = bytes.NewReader(encoded)
+	}
+
+	request.header.Set("Content-Type", "application/json")
+
+	return request
+}
+
+// WithBody sets a raw body.
+func (request *Request) WithBody(body io.Reader) *Request {
+	request.body = body
+
+	return request
+}
+
+// WithHeader adds a header.
+func (request *Request) WithHeader(name, value string) *Request {
+	request.header.Add(name, value)
+
+	return request
+}
+
+// WithBearer sets the Authorization header with the bearer token.
+func (request *Request) WithBearer(token string) *Request {
+	request.header.Set("Authorization", "Bearer "+token)
+
+	return request
+}
+
+// WithURLParam sets a URL parameter.
+func (request *Request) WithURLParam(name, value string) *Request {
+	request.urlParams[name] = value
+
+	return request
+}
+
+// WithQuery adds a query string parameter.
+func (request *Request) WithQuery(name, value string) *Request {
+	request.query.Add(name, value)
+
+	return request
+}
+
+// WithContext sets the context of the request.
+func (request *Request) WithContext(ctx context.Context) *Request {
+	request.ctx = ctx
+
+	return request
+}
+
+// Build returns the request for calling a handler directly: URL params are substituted in the path placeholders and
+// added to the chi route context, as the router would.
+func (request *Request) Build() *http.Request {
+	request.t.Helper()
+
+	return request.build(true)
+}
+
+// Do executes the request against the handler, which can be a chi router or a single handler.
+func (request *Request) Do(handler http.Handler) *Response {
+	request.t.Helper()
+
+	// Routers fill the route context themselves from the path, and would route an existing one as a sub-router.
+	_, isRouter := handler.(chi.Routes)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request.build(!isRouter))
+
+	return &Response{t: request.t, Recorder: recorder}
+}
+
+func (request *Request) build(withRouteContext bool) *http.Request {
+	path := request.path
+	for name, value := range request.urlParams {
+		path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+	}
+
+	if len(request.query) > 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+
+		path += separator + request.query.Encode()
+	}
+
+	req := httptest.NewRequest(request.method, path, request.body)
+	for name, values := range request.header {
+		req.Header[name] = values
+	}
+
+	ctx := request.ctx
+
+	if withRouteContext && len(request.urlParams) > 0 {
+		routeContext := chi.NewRouteContext()
+		for name, value := range request.urlParams {
+			routeContext.URLParams.Add(name, value)
+		}
+
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, routeContext)
+	}
+
+	return req.WithContext(ctx)
+}
+
+// Response the response of an executed request, with fluent assertions.
+type Response struct {
+	t        testing.TB
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status returns the status code.
+func (response *Response) Status() int {
+	return response.Recorder.Code
+}
+
+// Header returns the response headers.
+func (response *Response) Header() http.Header {
+	return response.Recorder.Header()
+}
+
+// Body returns the response body.
+func (response *Response) Body() string {
+	return response.Recorder.Body.String()
+}
+
+// DecodeJSON decodes the response body into dst, failing the test if it is not valid JSON.
+func (response *Response) DecodeJSON(dst interface{}) *Response {
+	response.t.Helper()
+
+	if err := json.Unmarshal(response.Recorder.Body.Bytes(), dst); err != nil {
+		response.t.Fatalf("error decoding response body %q: %v", response.Body(), err)
+	}
+
+	return response
+}
+
+// AssertStatus asserts the status code.
+func (response *Response) AssertStatus(status int) *Response {
+	response.t.Helper()
+
+	assert.Equal(response.t, status, response.Status(), "Status is not the expected, body: %s", response.Body())
+
+	return response
+}
+
+// AssertHeader asserts the first value of the header.
+func (response *Response) AssertHeader(name, value string) *Response {
+	response.t.Helper()
+
+	assert.Equal(response.t, value, response.Header().Get(name), "Header %s is not the expected", name)
+
+	return response
+}
+
+// AssertJSON asserts the response body is JSON equal to the expected one.
+func (response *Response) AssertJSON(expected string) *Response {
+	response.t.Helper()
+
+	assert.JSONEq(response.t, expected, response.Body(), "Body is not the expected")
+
+	return response
+}
+
+// AssertJSONPath asserts the value at the path of the JSON body, such as "items[0].id" or "total". The expected
+// value is compared after a JSON round trip, so ints match JSON numbers and structs match objects.
+func (response *Response) AssertJSONPath(path string, expected interface{}) *Response {
+	response.t.Helper()
+
+	var body interface{}
+	if err := json.Unmarshal(response.Recorder.Body.Bytes(), &body); err != nil {
+		response.t.Errorf("response body %q is not valid JSON: %v", response.Body(), err)
+
+		return response
+	}
+
+	actual, err := lookupJSONPath(body, path)
+	if err != nil {
+		response.t.Errorf("JSON path %s: %v, body: %s", path, err, response.Body())
+
+		return response
+	}
+
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		response.t.Fatalf("error encoding expected value: %v", err)
+	}
+
+	var normalized interface{}
+	_ = json.Unmarshal(encoded, &normalized)
+
+	assert.Equal(response.t, normalized, actual, "Value at JSON path %s is not the expected", path)
+
+	return response
+}
+
+// AssertGolden compares the body with the golden file testdata/<name>.golden. JSON bodies are indented before
+// comparing so the files are readable. Running the tests with UPDATE_GOLDEN=true rewrites the files.
+func (response *Response) AssertGolden(name string) *Response {
+	response.t.Helper()
+
+	actual := response.Recorder.Body.Bytes()
+
+	indented := &bytes.Buffer{}
+	if json.Indent(indented, actual, "", "  ") == nil {
+		actual = append(indented.Bytes(), '\n')
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if update, _ := strconv.ParseBool(os.Getenv(UpdateGoldenEnv)); update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			response.t.Fatalf("error creating golden file directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			response.t.Fatalf("error writing golden file %s: %v", path, err)
+		}
+
+		return response
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		response.t.Fatalf("error reading golden file %s, run with %s=true to create it: %v", path, UpdateGoldenEnv,
+			err)
+	}
+
+	assert.Equal(response.t, string(expected), string(actual), "Body does not match the golden file %s", path)
+
+	return response
+}
+
+// lookupJSONPath returns the value at a path of dot separated keys and [n] indexes.
+func lookupJSONPath(value interface{}, path string) (interface{}, error) {
+	for _, segment := range splitJSONPath(path) {
+		if index, err := strconv.Atoi(segment); err == nil {
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, &pathError{segment: segment, reason: "is not an array index"}
+			}
+
+			if index < 0 || index >= len(array) {
+				return nil, &pathError{segment: segment, reason: "is out of range"}
+			}
+
+			value = array[index]
+
+			continue
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, &pathError{segment: segment, reason: "is not an object key"}
+		}
+
+		value, ok = object[segment]
+		if !ok {
+			return nil, &pathError{segment: segment, reason: "is not found"}
+		}
+	}
+
+	return value, nil
+}
+
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var segments []string
+
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+type pathError struct {
+	segment string
+	reason  string
+}
+
+func (err *pathError) Error() string {
+	return "segment " + strconv.Quote(err.segment) + " " + err.reason
+}
@@ -0,0 +1,78 @@
+package webtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adminvoras/commons-lib/pkg/web"
+	"github.com/adminvoras/commons-lib/pkg/web/webtest"
+)
+
+type order struct {
+	ID       int    `json:"id"`
+	Customer string `json:"customer"`
+}
+
+func updateOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := web.URLParam(r, "id", web.ParseInt)
+	if err != nil {
+		_ = web.EncodeError(w, err)
+
+		return
+	}
+
+	body := order{}
+	if err := web.DecodeJSON(r, &body); err != nil {
+		_ = web.EncodeError(w, err)
+
+		return
+	}
+
+	body.ID = id
+	w.Header().Set("X-Dry-Run", r.URL.Query().Get("dry_run"))
+
+	_ = web.EncodeJSON(w, map[string]interface{}{"items": []order{body}, "total": 1}, http.StatusOK)
+}
+
+func TestRequest(t *testing.T) {
+	router := chi.NewRouter()
+	router.Put("/orders/{id}", updateOrder)
+
+	handlers := map[string]http.Handler{
+		"Router":  router,
+		"Handler": http.HandlerFunc(updateOrder),
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			webtest.NewRequest(t, http.MethodPut, "/orders/{id}").
+				WithURLParam("id", "7").
+				WithQuery("dry_run", "true").
+				WithHeader("X-Request-ID", "request-1").
+				WithJSON(order{Customer: "Acme"}).
+				Do(handler).
+				AssertStatus(http.StatusOK).
+				AssertHeader("X-Dry-Run", "true").
+				AssertJSONPath("total", 1).
+				AssertJSONPath("items[0]", order{ID: 7, Customer: "Acme"}).
+				AssertJSONPath("$.items[0].customer", "Acme").
+				AssertGolden("updated_order")
+		})
+	}
+}
+
+func TestResponseDecodeJSON(t *testing.T) {
+	response := webtest.NewRequest(t, http.MethodPut, "/orders/{id}").
+		WithURLParam("id", "x").
+		WithJSON(`{}`).
+		Do(http.HandlerFunc(updateOrder)).
+		AssertStatus(http.StatusBadRequest)
+
+	errorResponse := web.ErrorResponse{}
+	response.DecodeJSON(&errorResponse)
+
+	assert.Equal(t, `url parameter "id" must be an integer`, errorResponse.Message, "Message is not the expected")
+}